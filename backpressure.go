@@ -0,0 +1,74 @@
+package raven
+
+import "errors"
+
+// WithBackpressureCallback configures Client to call fn when number of
+// messages waiting in queue reaches high, and then again when it drops to
+// low or below after that. fn receives queue length at the moment of
+// transition: value of at least high signals that queue is backed up, value
+// not exceeding low signals recovery. fn is called from a separate goroutine
+// and should return quickly; if transitions happen while fn is running, only
+// the latest one is delivered once it returns, so fn always observes the
+// current state eventually.
+func WithBackpressureCallback(high, low int, fn func(depth int)) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if fn == nil {
+			return nil, errors.New("nil backpressure callback")
+		}
+		if low < 0 || low >= high {
+			return nil, errors.New("backpressure low-water mark should be in [0, high) range")
+		}
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.bpHigh, c.bpLow, c.bpFunc = high, low, fn
+		c.bpEvents = make(chan int, 1)
+		return c, nil
+	}
+}
+
+// checkBackpressure notifies backpressure callback if queue length crossed
+// high- or low-water mark
+func (c *Client) checkBackpressure() {
+	if c.bpFunc == nil {
+		return
+	}
+	depth := len(c.messages)
+	if depth < c.bpHigh && depth > c.bpLow {
+		return
+	}
+	// transitions are serialized, so that pending notification is always
+	// replaced with a later one
+	c.bpMu.Lock()
+	defer c.bpMu.Unlock()
+	switch {
+	case depth >= c.bpHigh && c.backedUp.CompareAndSwap(false, true):
+	case depth <= c.bpLow && c.backedUp.CompareAndSwap(true, false):
+	default:
+		return
+	}
+	for {
+		select {
+		case c.bpEvents <- depth:
+			return
+		default:
+		}
+		select {
+		case <-c.bpEvents: // drop stale notification not yet delivered
+		default:
+		}
+	}
+}
+
+// loopBackpressure calls backpressure callback until Client is closed
+func (c *Client) loopBackpressure() {
+	for {
+		select {
+		case depth := <-c.bpEvents:
+			c.bpFunc(depth)
+		case <-c.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package raven
+
+import "testing"
+
+func TestClient_checkBackpressure(t *testing.T) {
+	c, err := WithBackpressureCallback(3, 1, func(int) {})(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.messages = make(chan *message, 10)
+	for i := 0; i < 4; i++ {
+		c.Print("message")
+	}
+	if len(c.bpEvents) != 1 {
+		t.Fatalf("wrong number of notifications: got %d, want 1", len(c.bpEvents))
+	}
+	if depth := <-c.bpEvents; depth != 3 {
+		t.Fatalf("wrong queue length in high-water notification: got %d, want 3", depth)
+	}
+	for len(c.messages) > 0 {
+		<-c.messages
+		c.checkBackpressure()
+	}
+	if len(c.bpEvents) != 1 {
+		t.Fatalf("wrong number of notifications: got %d, want 1", len(c.bpEvents))
+	}
+	if depth := <-c.bpEvents; depth != 1 {
+		t.Fatalf("wrong queue length in low-water notification: got %d, want 1", depth)
+	}
+}
+
+func TestClient_checkBackpressureLatest(t *testing.T) {
+	c, err := WithBackpressureCallback(2, 0, func(int) {})(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.messages = make(chan *message, 10)
+	// notifications are not consumed, so every transition replaces the
+	// previous one
+	for i := 0; i < 3; i++ {
+		c.Print("message")
+		c.Print("message")
+		for len(c.messages) > 0 {
+			<-c.messages
+		}
+		c.checkBackpressure()
+	}
+	if len(c.bpEvents) != 1 {
+		t.Fatalf("wrong number of notifications: got %d, want 1", len(c.bpEvents))
+	}
+	if depth := <-c.bpEvents; depth != 0 {
+		t.Fatalf("last transition lost: got queue length %d, want 0", depth)
+	}
+}
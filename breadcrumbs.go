@@ -0,0 +1,70 @@
+package raven
+
+// maxBreadcrumbs is the number of most recent breadcrumbs reported with
+// every message
+const maxBreadcrumbs = 100
+
+// https://develop.sentry.dev/sdk/event-payloads/breadcrumbs/
+type breadcrumbs struct {
+	Values []breadcrumb `json:"values"`
+}
+
+type breadcrumb struct {
+	Timestamp string `json:"timestamp"`
+	Category  string `json:"category,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// WithBreadcrumbFilter configures Client to only record breadcrumbs of
+// categories for which fn returns true. Filter is applied when breadcrumb is
+// added, so rejected breadcrumbs do not evict recorded ones. This can be
+// used to keep noisy categories from pushing out important breadcrumbs.
+func WithBreadcrumbFilter(fn func(category string) bool) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.crumbFilter = fn
+		return c, nil
+	}
+}
+
+// AddBreadcrumb records an event that happened in the program, like an
+// outgoing request or a user action, with given category and message.
+// Breadcrumbs are recorded per Client and shared with all its subloggers; up
+// to 100 most recent ones are reported with every message, to show what led
+// to it. See also WithBreadcrumbFilter.
+func (c *Client) AddBreadcrumb(category, message string) {
+	if c == nil || c.shared == nil || (category == "" && message == "") {
+		return
+	}
+	if c.crumbFilter != nil && !c.crumbFilter(category) {
+		return
+	}
+	crumb := breadcrumb{
+		Timestamp: c.now().UTC().Format(sentryTimeFormat),
+		Category:  category,
+		Message:   message,
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.crumbs) == maxBreadcrumbs {
+		copy(c.crumbs, c.crumbs[1:])
+		c.crumbs = c.crumbs[:maxBreadcrumbs-1]
+	}
+	c.crumbs = append(c.crumbs, crumb)
+}
+
+// breadcrumbs returns copy of recorded breadcrumbs, or nil if there are none
+func (c *Client) breadcrumbs() *breadcrumbs {
+	if c == nil || c.shared == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.crumbs) == 0 {
+		return nil
+	}
+	return &breadcrumbs{Values: append([]breadcrumb(nil), c.crumbs...)}
+}
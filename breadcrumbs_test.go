@@ -0,0 +1,32 @@
+package raven
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestClient_AddBreadcrumb(t *testing.T) {
+	c, err := WithBreadcrumbFilter(func(category string) bool {
+		return category != "http"
+	})(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxBreadcrumbs+10; i++ {
+		c.AddBreadcrumb("auth", strconv.Itoa(i))
+		c.AddBreadcrumb("http", "GET /")
+	}
+	evt := newEvent("message", "", nil, AttachTags(c, map[string]string{"foo": "bar"}).(*Client))
+	if evt.Breadcrumbs == nil || len(evt.Breadcrumbs.Values) != maxBreadcrumbs {
+		t.Fatalf("wrong breadcrumbs: %+v", evt.Breadcrumbs)
+	}
+	for i, crumb := range evt.Breadcrumbs.Values {
+		if crumb.Category != "auth" || crumb.Message != strconv.Itoa(i+10) {
+			t.Fatalf("wrong breadcrumb %d: %+v", i, crumb)
+		}
+	}
+	c.AddBreadcrumb("auth", "new")
+	if evt.Breadcrumbs.Values[0].Message != "10" {
+		t.Fatal("event breadcrumbs modified after event creation")
+	}
+}
@@ -0,0 +1,48 @@
+package raven
+
+import (
+	"errors"
+	"time"
+)
+
+// Clock provides time for Client, it is used to make timing-dependent logic
+// testable. Default Clock uses functions of time package.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+// WithClock configures Client to use given Clock instead of the system one.
+// This is mostly useful for tests which need deterministic timestamps or want
+// to skip retry and backoff delays.
+func WithClock(clock Clock) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if clock == nil {
+			return nil, errors.New("nil clock")
+		}
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.clock = clock
+		return c, nil
+	}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// getClock returns Clock configured for Client, or system clock if none
+// configured or Client is nil
+func (c *Client) getClock() Clock {
+	if c == nil || c.clock == nil {
+		return systemClock{}
+	}
+	return c.clock
+}
+
+func (c *Client) now() time.Time { return c.getClock().Now() }
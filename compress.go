@@ -0,0 +1,87 @@
+package raven
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sync"
+)
+
+// WithGzip configures Client to compress message payloads with gzip. If
+// Sentry API (or a proxy in front of it) rejects compressed request with 400
+// Bad Request or 415 Unsupported Media Type status, Client retries it
+// uncompressed and stops compressing subsequent messages.
+func WithGzip(enable bool) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.gzip = enable
+		return c, nil
+	}
+}
+
+// WithCompressionLevel configures compression level used with WithGzip, it
+// should be one of gzip.DefaultCompression, gzip.NoCompression,
+// gzip.HuffmanOnly, or a value in [gzip.BestSpeed, gzip.BestCompression]
+// range. Default level is gzip.DefaultCompression.
+func WithCompressionLevel(level int) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			return nil, errors.New("invalid compression level")
+		}
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.gzipLevel = level
+		return c, nil
+	}
+}
+
+// gzipWriters holds pools of gzip writers for each compression level, index
+// is level-gzip.HuffmanOnly
+var gzipWriters [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+// compress replaces message payload with its version gzip-compressed with
+// given level
+func (m *message) compress(level int) error {
+	pool := &gzipWriters[level-gzip.HuffmanOnly]
+	buf := new(bytes.Buffer)
+	zw, _ := pool.Get().(*gzip.Writer)
+	if zw == nil {
+		var err error
+		if zw, err = gzip.NewWriterLevel(buf, level); err != nil {
+			return err
+		}
+	} else {
+		zw.Reset(buf)
+	}
+	defer pool.Put(zw)
+	if _, err := zw.Write(m.payload); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	m.payload = buf.Bytes()
+	m.gzipped = true
+	return nil
+}
+
+// decompress replaces gzip-compressed message payload with uncompressed one
+func (m *message) decompress() error {
+	zr, err := gzip.NewReader(bytes.NewReader(m.payload))
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return err
+	}
+	m.payload = data
+	m.gzipped = false
+	return nil
+}
@@ -0,0 +1,42 @@
+package raven
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestMessage_compress(t *testing.T) {
+	orig := newMessage("message", "", []interface{}{errors.New("error")}, nil)
+	for level := gzip.HuffmanOnly; level <= gzip.BestCompression; level++ {
+		msg := *orig
+		if err := msg.compress(level); err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if err := msg.decompress(); err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if !bytes.Equal(msg.payload, orig.payload) {
+			t.Fatalf("level %d: payload changed after compression round trip", level)
+		}
+	}
+}
+
+func BenchmarkMessage_compress(b *testing.B) {
+	orig := newMessage("message", "", []interface{}{errors.New("error")}, nil)
+	for _, level := range []int{gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression} {
+		b.Run(fmt.Sprintf("level=%d", level), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(orig.payload)))
+			for i := 0; i < b.N; i++ {
+				msg := *orig
+				if err := msg.compress(level); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
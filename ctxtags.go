@@ -0,0 +1,53 @@
+package raven
+
+import (
+	"context"
+	"errors"
+)
+
+// WithContextTagExtractor configures Client to derive tags from context passed
+// to context-aware methods, such as CaptureErrorContext and PrintfContext, with
+// fn. This allows to keep mapping of context values (tenant, region, trace ID)
+// to tags in one place. Tags returned by fn take precedence over Client and
+// sublogger tags. fn is called on the capture path, so it must be fast, and
+// it may be called concurrently.
+func WithContextTagExtractor(fn func(ctx context.Context) map[string]string) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if fn == nil {
+			return nil, errors.New("nil context tag extractor")
+		}
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.ctxTags = fn
+		return c, nil
+	}
+}
+
+// contextTags returns tags extracted from ctx by function configured with
+// WithContextTagExtractor
+func (c *Client) contextTags(ctx context.Context) map[string]string {
+	if c.ctxTags == nil || ctx == nil {
+		return nil
+	}
+	return c.ctxTags(ctx)
+}
+
+// CaptureErrorContext creates new error event for err with tags derived from
+// ctx and pushes it to outgoing queue, see WithContextTagExtractor.
+func (c *Client) CaptureErrorContext(ctx context.Context, err error) {
+	if c == nil {
+		return
+	}
+	c.CaptureErrorWith(err, c.contextTags(ctx), nil)
+}
+
+// PrintfContext is like Printf, but also sends tags derived from ctx, see
+// WithContextTagExtractor.
+func (c *Client) PrintfContext(ctx context.Context, format string, v ...interface{}) {
+	if c == nil {
+		return
+	}
+	AttachTags(c, c.contextTags(ctx)).(*Client).Printf(format, v...)
+}
@@ -0,0 +1,39 @@
+package raven_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/artyom/raven"
+)
+
+// TestCallerCulprit is in a separate package, as frames of raven package,
+// including its tests, are never reported as culprit
+func TestCallerCulprit(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c, err := raven.New(raven.WithLocalSink(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Print(errors.New("plain error"))
+	c.Printf("message %d", 1)
+	log.New(c, "", 0).Print("log line")
+	c.Close()
+	c.Wait()
+	dec := json.NewDecoder(buf)
+	for i := 0; i < 3; i++ {
+		var evt struct {
+			Culprit string `json:"culprit"`
+		}
+		if err := dec.Decode(&evt); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(evt.Culprit, "culprit_test.go:") {
+			t.Errorf("message %d: wrong culprit: %q", i, evt.Culprit)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package raven
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime/debug"
+)
+
+// debugMeta is a Sentry debug_meta interface holding information used for
+// server-side symbolication
+//
+// https://develop.sentry.dev/sdk/event-payloads/debugmeta/
+type debugMeta struct {
+	Images []debugImage `json:"images"`
+}
+
+type debugImage struct {
+	Type     string `json:"type"`
+	CodeFile string `json:"code_file,omitempty"`
+	CodeID   string `json:"code_id"`
+	DebugID  string `json:"debug_id"`
+}
+
+// buildModules returns mapping of module paths to their versions for modules
+// the program was built with
+func buildModules() map[string]string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	out := make(map[string]string, len(info.Deps)+1)
+	if info.Main.Path != "" {
+		out[info.Main.Path] = info.Main.Version
+	}
+	for _, m := range info.Deps {
+		if m.Replace != nil {
+			m = m.Replace
+		}
+		out[m.Path] = m.Version
+	}
+	return out
+}
+
+// vcsRevision returns VCS revision the program was built from, or empty
+// string if it is unknown
+func vcsRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	return settingsRevision(info.Settings)
+}
+
+// settingsRevision returns VCS revision recorded in build settings, with
+// "-dirty" suffix if working tree was modified
+func settingsRevision(settings []debug.BuildSetting) string {
+	var revision string
+	var modified bool
+	for _, s := range settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision != "" && modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// buildDebugMeta returns debug_meta interface describing current executable.
+// It returns nil if executable is not an ELF file or has no GNU build ID (Go
+// linker only adds it when building with -ldflags=-B=gobuildid or when
+// linking externally).
+func buildDebugMeta() *debugMeta {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	f, err := elf.Open(exe)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	sec := f.Section(".note.gnu.build-id")
+	if sec == nil {
+		return nil
+	}
+	note, err := sec.Data()
+	if err != nil {
+		return nil
+	}
+	buildID := parseBuildIDNote(note, f.ByteOrder)
+	if len(buildID) < 16 {
+		return nil
+	}
+	return &debugMeta{Images: []debugImage{{
+		Type:     "elf",
+		CodeFile: exe,
+		CodeID:   hex.EncodeToString(buildID),
+		DebugID:  elfDebugID(buildID),
+	}}}
+}
+
+// parseBuildIDNote returns build ID from the content of ELF
+// .note.gnu.build-id section
+func parseBuildIDNote(note []byte, bo binary.ByteOrder) []byte {
+	if len(note) < 12 {
+		return nil
+	}
+	nameSize, descSize := bo.Uint32(note), bo.Uint32(note[4:])
+	if bo.Uint32(note[8:]) != 3 { // NT_GNU_BUILD_ID
+		return nil
+	}
+	off := 12 + (nameSize+3)&^3
+	if uint32(len(note)) < off+descSize {
+		return nil
+	}
+	return note[off : off+descSize]
+}
+
+// elfDebugID returns Sentry debug ID derived from ELF build ID: its first 16
+// bytes are formatted as little-endian GUID.
+func elfDebugID(buildID []byte) string {
+	b := make([]byte, 16)
+	copy(b, buildID)
+	b[0], b[1], b[2], b[3] = b[3], b[2], b[1], b[0]
+	b[4], b[5] = b[5], b[4]
+	b[6], b[7] = b[7], b[6]
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -4,55 +4,59 @@ import (
 	"errors"
 	"net/url"
 	"path"
-	"strconv"
+	"strings"
 )
 
+const projectChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+
 // parseDSN parses Sentry DSN specification returning url endpoint,
-// X-Sentry-Auth authentication header values with public and secret keys and
-// error, if any.
+// X-Sentry-Auth authentication header values with public and secret keys, DSN
+// query parameters and error, if any.
 //
 // For parsing logic see
 // https://docs.sentry.io/clientdev/overview/#parsing-the-dsn
-func parseDSN(dsn string) (string, []string, error) {
+//
+// Secret key is optional, as it is deprecated by Sentry and not used by
+// Sentry-compatible servers like GlitchTip. Project identifier is not required
+// to be numeric, it may consist of ASCII letters, digits, dashes and
+// underscores.
+func parseDSN(dsn string) (string, []string, url.Values, error) {
 	u, err := url.Parse(dsn)
 	if err != nil {
-		return "", nil, err
+		return "", nil, nil, err
 	}
 	api := new(url.URL)
 	switch u.Scheme {
 	case "http", "https":
 		api.Scheme = u.Scheme
 	default:
-		return "", nil, errors.New("unsupported DSN scheme")
+		return "", nil, nil, errors.New("unsupported DSN scheme")
 	}
 	if u.Host == "" {
-		return "", nil, errors.New("empty DSN host")
+		return "", nil, nil, errors.New("empty DSN host")
 	}
 	api.Host = u.Host
 	dir, project := path.Split(u.Path)
 	if dir == "" {
-		return "", nil, errors.New("empty DSN path")
+		return "", nil, nil, errors.New("empty DSN path")
 	}
 	if project == "" {
-		return "", nil, errors.New("empty DSN project")
+		return "", nil, nil, errors.New("empty DSN project")
 	}
-	if _, err := strconv.Atoi(project); err != nil {
-		return "", nil, errors.New("bad DNS project value")
+	if strings.Trim(project, projectChars) != "" {
+		return "", nil, nil, errors.New("bad DSN project value")
 	}
 	if u.User == nil {
-		return "", nil, errors.New("empty DSN credentials")
+		return "", nil, nil, errors.New("empty DSN credentials")
 	}
 	if u.User.Username() == "" {
-		return "", nil, errors.New("empty DSN public key")
+		return "", nil, nil, errors.New("empty DSN public key")
 	}
 	headers := make([]string, 0, 2)
 	headers = append(headers, "sentry_key="+u.User.Username())
-	switch p, _ := u.User.Password(); p {
-	case "":
-		return "", nil, errors.New("empty DSN private key")
-	default:
+	if p, _ := u.User.Password(); p != "" {
 		headers = append(headers, "sentry_secret="+p)
 	}
 	api.Path = path.Join(dir, "api", project, "store") + "/"
-	return api.String(), headers, nil
+	return api.String(), headers, u.Query(), nil
 }
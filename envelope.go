@@ -0,0 +1,51 @@
+package raven
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// attachment is a file sent along with the event using envelope endpoint
+type attachment struct {
+	name string
+	data []byte
+}
+
+const (
+	maxAttachmentSize  = 256 << 10 // max. size of a single attachment
+	maxAttachmentsSize = 1 << 20   // max. total size of all event attachments
+)
+
+// envelope returns event payload wrapped in envelope format together with
+// given attachments.
+//
+// For envelope format see https://develop.sentry.dev/sdk/envelopes/
+func envelope(eventID string, payload []byte, attachments []attachment) []byte {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf) // Encode adds trailing newline
+	enc.Encode(struct {
+		ID string `json:"event_id"`
+	}{eventID})
+	type itemHeader struct {
+		Type     string `json:"type"`
+		Length   int    `json:"length"`
+		Filename string `json:"filename,omitempty"`
+	}
+	enc.Encode(itemHeader{Type: "event", Length: len(payload)})
+	buf.Write(payload)
+	buf.WriteByte('\n')
+	for _, a := range attachments {
+		enc.Encode(itemHeader{Type: "attachment", Length: len(a.data), Filename: a.name})
+		buf.Write(a.data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// envelopeURL returns envelope endpoint URL from store endpoint URL
+func envelopeURL(storeURL string) string {
+	return strings.TrimSuffix(storeURL, "store/") + "envelope/"
+}
+
+const envelopeContentType = "application/x-sentry-envelope"
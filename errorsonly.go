@@ -0,0 +1,36 @@
+package raven
+
+// ErrorsOnly returns Logger which only sends messages to Sentry if their
+// arguments contain a non-nil error value; other messages are only forwarded
+// to Logger configured with WithLogger, subject to WithForwardLevel. Unlike
+// WithMinLevel, this depends on actual error values, not on message levels.
+// Returned Logger is not *Client, so functions creating subloggers, like
+// AttachTags, return it as is; create subloggers from c before passing it to
+// ErrorsOnly.
+func ErrorsOnly(c *Client) Logger { return errorsOnly{c} }
+
+type errorsOnly struct{ c *Client }
+
+func (l errorsOnly) Print(v ...interface{}) {
+	if valuesLevel(v) == LevelError {
+		l.c.Print(v...)
+	} else if l.c.forward(LevelInfo) {
+		l.c.log.Print(v...)
+	}
+}
+
+func (l errorsOnly) Printf(format string, v ...interface{}) {
+	if valuesLevel(v) == LevelError {
+		l.c.Printf(format, v...)
+	} else if l.c.forward(LevelInfo) {
+		l.c.log.Printf(format, v...)
+	}
+}
+
+func (l errorsOnly) Println(v ...interface{}) {
+	if valuesLevel(v) == LevelError {
+		l.c.Println(v...)
+	} else if l.c.forward(LevelInfo) {
+		l.c.log.Println(v...)
+	}
+}
@@ -0,0 +1,29 @@
+package raven
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+)
+
+func TestErrorsOnly(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := &Client{
+		shared:   new(shared),
+		messages: make(chan *message, 10),
+		log:      log.New(buf, "", 0),
+	}
+	l := ErrorsOnly(c)
+	l.Print("informational message")
+	l.Printf("value: %d", 42)
+	l.Println("failure:", errors.New("boom"))
+	if n := len(c.messages); n != 1 {
+		t.Fatalf("wrong number of queued messages: got %d, want 1", n)
+	}
+	want := "informational message\nvalue: 42\nfailure: boom\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("wrong local output: got %q, want %q", got, want)
+	}
+	ErrorsOnly(nil).Print("no-op")
+}
@@ -0,0 +1,259 @@
+package raven
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Event is a Sentry event built explicitly, as opposed to events created
+// by logging methods of Client. Use NewEvent to create Event and
+// Client.Capture to send it.
+type Event struct {
+	ID          string    // event ID, generated by Client if empty
+	Message     string    // human-readable event description
+	Timestamp   time.Time // event time, current time if zero
+	Level       Severity  // event severity, derived from Errors if zero
+	Culprit     string    // function or transaction that caused event
+	Platform    string    // platform, Client platform if empty or unknown
+	ServerName  string    // host name, Client host name if empty
+	Environment string    // environment name, Client one if empty
+	Release     string    // release version, Client one if empty
+
+	// Tags are merged with Client tags, taking precedence over them
+	Tags map[string]string
+	// Extra are merged with Client extra data, taking precedence over it;
+	// values are encoded as JSON.
+	Extra map[string]interface{}
+	// Errors are reported as event exceptions
+	Errors []error
+	// Fingerprint overrides default Sentry grouping of events
+	Fingerprint []string
+
+	evt *event // internal event this Event was exported from, if any
+}
+
+// NewEvent returns new Event with empty Tags and Extra. Its Level is not set,
+// so Capture derives it the same way as logging methods do: LevelError (or
+// level configured with WithLevelFromError) if event has Errors, LevelInfo
+// otherwise. Level set explicitly takes precedence.
+func NewEvent() *Event {
+	return &Event{
+		Tags:  make(map[string]string),
+		Extra: make(map[string]interface{}),
+	}
+}
+
+// Capture pushes event e to outgoing queue and returns its ID. Fields not
+// set in e are filled from Client configuration, the same way as for events
+// created by logging methods. Capture returns empty string if event was not
+// queued because c is nil or disabled.
+func (c *Client) Capture(e *Event) string {
+	if c == nil || e == nil || c.isDisabled() {
+		return ""
+	}
+	vals := make([]interface{}, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		if err != nil {
+			vals = append(vals, err)
+		}
+	}
+	text := e.Message
+	if text == "" && len(vals) > 0 {
+		text = vals[0].(error).Error()
+	}
+	evt := newEvent(text, "", vals, c)
+	if e.ID != "" {
+		evt.ID = normalizeID(e.ID)
+	}
+	if !e.Timestamp.IsZero() {
+		evt.setTime(e.Timestamp)
+	}
+	if e.Level.valid() {
+		evt.Level = e.Level
+	}
+	if e.Culprit != "" {
+		evt.Culprit = e.Culprit
+	}
+	if e.Platform != "" {
+		if platform := strings.ToLower(e.Platform); platformName.MatchString(platform) {
+			evt.Platform = platform
+		} else if c.log != nil {
+			c.log.Printf("raven ignores invalid platform %q of event %s", e.Platform, evt.ID)
+		}
+	}
+	if e.ServerName != "" {
+		evt.Hostname = e.ServerName
+	}
+	if e.Environment != "" {
+		evt.Environment = e.Environment
+	}
+	if e.Release != "" {
+		evt.Release = e.Release
+	}
+	if len(e.Fingerprint) > 0 {
+		evt.Fingerprint = e.Fingerprint
+	}
+	if len(e.Tags) > 0 {
+		evt.Tags = mergeTags(evt.Tags, e.Tags)
+	}
+	if len(e.Extra) > 0 {
+		if err := evt.mergeExtra(e.Extra); err != nil && c.log != nil {
+			c.log.Printf("raven failed to encode extra data: %v", err)
+		}
+	}
+	c.push(evt.message(c))
+	if c.forward(evt.Level) {
+		c.log.Print(text)
+	}
+	return evt.ID
+}
+
+// WithFingerprintFunc configures Client to call fn for every event about to be
+// sent and use returned values as event fingerprint, which controls how
+// Sentry groups events. fn receives a snapshot of event, its modifications
+// are discarded. If fn returns nil or empty slice, event fingerprint is left
+// as is: Sentry default grouping is used unless fingerprint was set by
+// Capture or WithFormatFingerprint. Unlike per-event fingerprints, this keeps
+// grouping policy in a single place:
+//
+//	raven.WithFingerprintFunc(func(e *raven.Event) []string {
+//		if e.Tags["component"] == "db" {
+//			return []string{"db", e.Message}
+//		}
+//		return nil
+//	})
+func WithFingerprintFunc(fn func(e *Event) []string) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.fingerprintFunc = fn
+		return c, nil
+	}
+}
+
+// Encoder encodes event into a payload sent to Sentry. See WithEncoder.
+type Encoder func(*Event) ([]byte, error)
+
+// WithEncoder configures Client to encode events with fn instead of
+// encoding/json. Event passed to fn is a snapshot of event about to be sent;
+// it holds only the fields exported by Event, so fn should either produce
+// the same wire format as DefaultEncoder or call DefaultEncoder for events
+// it cannot handle. If fn returns an error, Client falls back to a minimal
+// event the same way it does for encoding/json errors.
+func WithEncoder(fn Encoder) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.encoder = fn
+		return c, nil
+	}
+}
+
+// DefaultEncoder encodes e to JSON using encoding/json. For events passed to
+// Encoder by Client its output is the same as Client produces when no
+// Encoder is configured, including data not exported by Event, like stack
+// traces and request details.
+func DefaultEncoder(e *Event) ([]byte, error) {
+	if e == nil {
+		return nil, errNilEvent
+	}
+	return json.Marshal(e.wire())
+}
+
+var errNilEvent = errors.New("nil event")
+
+// encode returns evt encoded with Client encoder, if any, or encoding/json.
+func (c *Client) encode(evt *event) ([]byte, error) {
+	if c == nil || c.encoder == nil {
+		return json.Marshal(evt)
+	}
+	return c.encoder(evt.export())
+}
+
+// export returns Event holding fields of evt. Tags, Extra and Fingerprint are
+// copies, so they can be modified without affecting evt.
+func (evt *event) export() *Event {
+	e := &Event{
+		ID:          evt.ID,
+		Message:     evt.Text,
+		Timestamp:   evt.ts,
+		Level:       evt.Level,
+		Culprit:     evt.Culprit,
+		Platform:    evt.Platform,
+		ServerName:  evt.Hostname,
+		Environment: evt.Environment,
+		Release:     evt.Release,
+		Fingerprint: append([]string(nil), evt.Fingerprint...),
+		evt:         evt,
+	}
+	if len(evt.Tags) > 0 {
+		e.Tags = make(map[string]string, len(evt.Tags))
+		for k, v := range evt.Tags {
+			e.Tags[k] = v
+		}
+	}
+	if len(evt.Extra) > 0 {
+		// numbers are kept as json.Number so they are encoded back as is
+		dec := json.NewDecoder(bytes.NewReader(evt.Extra))
+		dec.UseNumber()
+		if err := dec.Decode(&e.Extra); err != nil {
+			e.Extra = nil
+		}
+	}
+	for _, x := range evt.Exceptions {
+		e.Errors = append(e.Errors, x.err)
+	}
+	return e
+}
+
+// wire returns internal event with fields of e applied over the event e was
+// exported from. If Extra could not be exported, original extra data is
+// kept.
+func (e *Event) wire() *event {
+	evt := new(event)
+	if e.evt != nil {
+		*evt = *e.evt
+	}
+	evt.ID = e.ID
+	evt.Text = e.Message
+	if !e.Timestamp.IsZero() {
+		evt.setTime(e.Timestamp)
+	}
+	evt.Level = e.Level
+	evt.Culprit = e.Culprit
+	evt.Platform = e.Platform
+	if evt.Platform == "" {
+		evt.Platform = "go"
+	}
+	evt.Hostname = e.ServerName
+	evt.Environment = e.Environment
+	evt.Release = e.Release
+	evt.Tags = e.Tags
+	evt.Fingerprint = e.Fingerprint
+	if e.Extra != nil {
+		if data, err := encodeExtra(evt.marshal, e.Extra); err == nil && isJSONObject(data) {
+			evt.Extra = data
+		}
+	}
+	var vars map[string]string // see AttachFrameVars
+	if len(evt.Exceptions) > 0 {
+		vars = evt.Exceptions[0].vars
+	}
+	evt.Exceptions = nil
+	for _, err := range e.Errors {
+		if err != nil {
+			evt.Exceptions = append(evt.Exceptions, ravenException{err: err})
+		}
+	}
+	if len(evt.Exceptions) > 0 {
+		evt.Exceptions[0].vars = vars
+	}
+	return evt
+}
@@ -0,0 +1,200 @@
+package raven
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestClient_Capture(t *testing.T) {
+	c := &Client{
+		shared:   new(shared),
+		messages: make(chan *message, 1),
+		tags:     map[string]string{"foo": "client", "bar": "client"},
+	}
+	e := NewEvent()
+	e.Message = "custom event"
+	e.Level = LevelWarning
+	e.Timestamp = time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	e.Tags["foo"] = "event"
+	e.Extra["num"] = 42
+	e.Errors = []error{errors.New("event error")}
+	id := c.Capture(e)
+	if len(id) != 32 {
+		t.Fatalf("invalid event ID: %q", id)
+	}
+	msg := <-c.messages
+	var evt struct {
+		ID         string            `json:"event_id"`
+		Text       string            `json:"message"`
+		Timestamp  string            `json:"timestamp"`
+		Level      string            `json:"level"`
+		Tags       map[string]string `json:"tags"`
+		Extra      map[string]int    `json:"extra"`
+		Exceptions []interface{}     `json:"exception"`
+	}
+	if err := json.Unmarshal(msg.payload, &evt); err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case evt.ID != id:
+		t.Errorf("wrong event ID: got %q, want %q", evt.ID, id)
+	case evt.Text != e.Message:
+		t.Errorf("wrong message: got %q, want %q", evt.Text, e.Message)
+	case evt.Timestamp != "2018-01-02T03:04:05":
+		t.Errorf("wrong timestamp: %q", evt.Timestamp)
+	case evt.Level != "warning":
+		t.Errorf("wrong level: %q", evt.Level)
+	case evt.Tags["foo"] != "event" || evt.Tags["bar"] != "client":
+		t.Errorf("wrong tags: %v", evt.Tags)
+	case evt.Extra["num"] != 42:
+		t.Errorf("wrong extra: %v", evt.Extra)
+	case len(evt.Exceptions) != 1:
+		t.Errorf("wrong number of exceptions: %d", len(evt.Exceptions))
+	}
+	if c.tags["foo"] != "client" {
+		t.Error("Capture modified client tags")
+	}
+	c.SetEnabled(false)
+	if id := c.Capture(NewEvent()); id != "" {
+		t.Errorf("disabled client returned event ID %q", id)
+	}
+}
+
+func TestClient_CaptureLevel(t *testing.T) {
+	c := newTestClient(t, WithLevelFromError(func(err error) (Severity, bool) {
+		return LevelWarning, err == io.EOF
+	}))
+	for _, tc := range []struct {
+		level Severity
+		err   error
+		want  string
+	}{
+		{0, nil, "info"},
+		{0, errors.New("plain"), "error"},
+		{0, io.EOF, "warning"},
+		{LevelFatal, io.EOF, "fatal"},
+	} {
+		e := NewEvent()
+		e.Level = tc.level
+		if tc.err != nil {
+			e.Errors = []error{tc.err}
+		}
+		c.Capture(e)
+		var evt struct {
+			Level string `json:"level"`
+		}
+		if err := json.Unmarshal((<-c.messages).payload, &evt); err != nil {
+			t.Fatal(err)
+		}
+		if evt.Level != tc.want {
+			t.Errorf("level %v, error %v: got %q, want %q", tc.level, tc.err, evt.Level, tc.want)
+		}
+	}
+}
+
+func TestClient_CapturePlatform(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := newTestClient(t, WithLogger(log.New(buf, "", 0)))
+	for _, tc := range []struct{ platform, want string }{
+		{"Python", "python"},
+		{"Lua", "lua"},
+		{"cobol 74", "go"},
+	} {
+		e := NewEvent()
+		e.Platform = tc.platform
+		c.Capture(e)
+		var evt struct {
+			Platform string `json:"platform"`
+		}
+		if err := json.Unmarshal((<-c.messages).payload, &evt); err != nil {
+			t.Fatal(err)
+		}
+		if evt.Platform != tc.want {
+			t.Errorf("platform %q: got %q, want %q", tc.platform, evt.Platform, tc.want)
+		}
+	}
+	if !strings.Contains(buf.String(), `invalid platform "cobol 74"`) {
+		t.Fatalf("invalid platform not logged: %q", buf.String())
+	}
+}
+
+func TestDefaultEncoder(t *testing.T) {
+	c := &Client{
+		tags:   map[string]string{"foo": "bar"},
+		extra:  json.RawMessage(`{"big":12345678901234567890}`),
+		shared: new(shared),
+	}
+	evt := newEvent("text", "", []interface{}{errors.New("some error")}, c)
+	want, err := json.Marshal(evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var called bool
+	c.encoder = func(e *Event) ([]byte, error) {
+		called = true
+		return DefaultEncoder(e)
+	}
+	got, err := c.encode(evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("custom encoder was not called")
+	}
+	if string(got) != string(want) {
+		t.Fatalf("DefaultEncoder output differs from encoding/json:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	c.encoder = func(e *Event) ([]byte, error) {
+		e.Tags["foo"] = "modified"
+		return DefaultEncoder(e)
+	}
+	if got, err = c.encode(evt); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), `"foo":"modified"`) {
+		t.Errorf("encoder modification is not applied: %s", got)
+	}
+	if evt.Tags["foo"] != "bar" || c.tags["foo"] != "bar" {
+		t.Error("encoder modified original tags")
+	}
+}
+
+func TestWithFingerprintFunc(t *testing.T) {
+	c, err := WithFingerprintFunc(func(e *Event) []string {
+		if e.Tags["component"] != "db" {
+			return nil
+		}
+		e.Tags["component"] = "modified"
+		return []string{"db", e.Message}
+	})(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := AttachTags(c, map[string]string{"component": "db"})
+	l.Print("query failed")
+	c.Print("other message")
+	for _, want := range [][]string{{"db", "query failed"}, nil} {
+		var evt struct {
+			Fingerprint []string          `json:"fingerprint"`
+			Tags        map[string]string `json:"tags"`
+		}
+		if err := json.Unmarshal((<-c.messages).payload, &evt); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(evt.Fingerprint, want) {
+			t.Errorf("wrong fingerprint: got %q, want %q", evt.Fingerprint, want)
+		}
+		if evt.Tags["component"] == "modified" {
+			t.Error("fingerprint function modified event tags")
+		}
+	}
+}
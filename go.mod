@@ -1,3 +1,5 @@
 module github.com/artyom/raven
 
+go 1.20
+
 require github.com/pkg/errors v0.8.0
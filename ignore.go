@@ -0,0 +1,72 @@
+package raven
+
+import "errors"
+
+// WithIgnoreErrors configures Client to not send messages whose errors match
+// any of errs, as reported by errors.Is applied to each error in the chain of
+// wrapped errors (including errors wrapped with github.com/pkg/errors).
+// Messages are dropped only if all their errors are ignored. Ignored messages
+// are still forwarded to Logger configured with WithLogger.
+func WithIgnoreErrors(errs ...error) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		for _, err := range errs {
+			if err != nil {
+				c.ignoreErrs = append(c.ignoreErrs, err)
+			}
+		}
+		return c, nil
+	}
+}
+
+// WithIgnoreErrorTypes configures Client to not send messages whose errors
+// match any of matchers. Matcher is called with each error in the chain of
+// wrapped errors, so it can use type assertion or errors.As to match error
+// of a specific type. Messages are dropped only if all their errors are
+// ignored. Ignored messages are still forwarded to Logger configured with
+// WithLogger.
+func WithIgnoreErrorTypes(matchers ...func(error) bool) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		for _, fn := range matchers {
+			if fn != nil {
+				c.ignoreFuncs = append(c.ignoreFuncs, fn)
+			}
+		}
+		return c, nil
+	}
+}
+
+// ignored reports whether every error of errs should not be sent as
+// configured with WithIgnoreErrors and WithIgnoreErrorTypes
+func (c *Client) ignored(errs []error) bool {
+	if c == nil || len(errs) == 0 ||
+		(len(c.ignoreErrs) == 0 && len(c.ignoreFuncs) == 0) {
+		return false
+	}
+	for _, err := range errs {
+		if !c.ignoredError(err) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Client) ignoredError(err error) bool {
+	var match bool
+	walkErrors(err, func(err error) {
+		for _, target := range c.ignoreErrs {
+			match = match || errors.Is(err, target)
+		}
+		for _, fn := range c.ignoreFuncs {
+			match = match || fn(err)
+		}
+	})
+	return match
+}
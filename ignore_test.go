@@ -0,0 +1,31 @@
+package raven
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestClient_ignoreErrors(t *testing.T) {
+	c, err := WithIgnoreErrors(context.Canceled, io.EOF)(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err = WithIgnoreErrorTypes(func(err error) bool {
+		_, ok := err.(*os.PathError)
+		return ok
+	})(c); err != nil {
+		t.Fatal(err)
+	}
+	c.messages = make(chan *message, 10)
+	c.Print("canceled: ", errors.Wrap(context.Canceled, "wrapped"))
+	c.Print(&os.PathError{Op: "open", Path: "foo", Err: os.ErrNotExist})
+	c.Print(io.EOF, errors.New("unexpected"))
+	c.Print("no errors")
+	if n := len(c.messages); n != 2 {
+		t.Fatalf("wrong number of queued messages: got %d, want 2", n)
+	}
+}
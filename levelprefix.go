@@ -0,0 +1,106 @@
+package raven
+
+import "strings"
+
+// WithLevelPrefixParser configures Client to extract message level from text
+// written with Client.Write, i.e. when Client is used as log.Logger output.
+// fn is called with every written line and returns level and the rest of
+// line to be used as message text. If returned level is not valid (i.e.
+// zero), line is reported as is, with default level. ParseLevelPrefix can be
+// used as fn for the most common prefix styles.
+func WithLevelPrefixParser(fn func(line string) (Severity, string)) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.levelPrefix = fn
+		return c, nil
+	}
+}
+
+var prefixLevels = map[string]Severity{
+	"debug":    LevelDebug,
+	"info":     LevelInfo,
+	"warn":     LevelWarning,
+	"warning":  LevelWarning,
+	"err":      LevelError,
+	"error":    LevelError,
+	"crit":     LevelFatal,
+	"critical": LevelFatal,
+	"fatal":    LevelFatal,
+}
+
+// ParseLevelPrefix extracts level from line starting with level name either
+// in square brackets or followed by a colon, like "[ERROR] text" or "warn:
+// text". Level names are case-insensitive; recognized names are debug, info,
+// warn, warning, err, error, crit, critical and fatal. Date and time written
+// by log.Logger with log.Ldate and log.Ltime (optionally with
+// log.Lmicroseconds) flags are skipped, so level prefix is recognized with
+// default log flags as well; other prefixes, like the one set with
+// log.SetPrefix or file name added with log.Lshortfile, should either be
+// moved after level with log.Lmsgprefix flag or not be used. If line has no
+// level prefix, ParseLevelPrefix returns zero Severity and line unmodified. It
+// is meant to be used with WithLevelPrefixParser.
+func ParseLevelPrefix(line string) (Severity, string) {
+	s := trimLogTime(strings.TrimLeft(line, " \t"))
+	var name string
+	switch i := strings.IndexAny(s, "]: \t"); {
+	case strings.HasPrefix(s, "["):
+		j := strings.IndexByte(s, ']')
+		if j < 0 {
+			return 0, line
+		}
+		name, s = s[1:j], s[j+1:]
+	case i > 0 && s[i] == ':':
+		name, s = s[:i], s[i+1:]
+	default:
+		return 0, line
+	}
+	level, ok := prefixLevels[strings.ToLower(name)]
+	if !ok {
+		return 0, line
+	}
+	return level, strings.TrimLeft(s, " \t")
+}
+
+// trimLogTime removes date and time in the format written by log.Logger from
+// the start of s
+func trimLogTime(s string) string {
+	if matchLayout(s, "0000/00/00 ") {
+		s = s[len("0000/00/00 "):]
+	}
+	if !matchLayout(s, "00:00:00") {
+		return s
+	}
+	i := len("00:00:00")
+	if i < len(s) && s[i] == '.' {
+		for i++; i < len(s) && '0' <= s[i] && s[i] <= '9'; i++ {
+		}
+	}
+	if i < len(s) && s[i] == ' ' {
+		return s[i+1:]
+	}
+	return s
+}
+
+// matchLayout reports whether s starts with layout, where each '0' in layout
+// matches any decimal digit
+func matchLayout(s, layout string) bool {
+	if len(s) < len(layout) {
+		return false
+	}
+	for i := 0; i < len(layout); i++ {
+		switch c := s[i]; layout[i] {
+		case '0':
+			if c < '0' || c > '9' {
+				return false
+			}
+		default:
+			if c != layout[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package raven
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+)
+
+func TestParseLevelPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		line  string
+		level Severity
+		text  string
+	}{
+		{"[ERROR] disk full\n", LevelError, "disk full\n"},
+		{"  WARN: low memory", LevelWarning, "low memory"},
+		{"debug:details", LevelDebug, "details"},
+		{"[Fatal]", LevelFatal, ""},
+		{"[trace] details", 0, "[trace] details"},
+		{"[ERROR disk full", 0, "[ERROR disk full"},
+		{"error occurred: disk full", 0, "error occurred: disk full"},
+		{"12:00:00 error", 0, "12:00:00 error"},
+		{"2009/01/23 01:23:23 [ERROR] disk full", LevelError, "disk full"},
+		{"01:23:23.123456 warn: low memory", LevelWarning, "low memory"},
+		{"2009/01/23 plain line", 0, "2009/01/23 plain line"},
+		{"", 0, ""},
+	} {
+		level, text := ParseLevelPrefix(tc.line)
+		if level != tc.level || text != tc.text {
+			t.Errorf("ParseLevelPrefix(%q) = %v, %q; want %v, %q",
+				tc.line, level, text, tc.level, tc.text)
+		}
+	}
+}
+
+func TestClient_WriteLevelPrefix(t *testing.T) {
+	c := &Client{
+		shared:      new(shared),
+		messages:    make(chan *message, 4),
+		levelPrefix: ParseLevelPrefix,
+	}
+	c.Write([]byte("[WARN] low memory\n"))
+	c.Write([]byte("plain line\n"))
+	log.New(c, "", log.LstdFlags).Print("[ERROR] disk full")
+	log.New(c, "", log.LstdFlags|log.Lmicroseconds|log.Lmsgprefix).Print("debug: details")
+	for _, want := range []struct {
+		text, level string
+	}{
+		{"low memory\n", "warning"},
+		{"plain line\n", "info"},
+		{"disk full\n", "error"},
+		{"details\n", "debug"},
+	} {
+		var evt struct {
+			Text  string `json:"message"`
+			Level string `json:"level"`
+		}
+		if err := json.Unmarshal((<-c.messages).payload, &evt); err != nil {
+			t.Fatal(err)
+		}
+		if evt.Text != want.text || evt.Level != want.level {
+			t.Errorf("got message %q with level %q, want %q with level %q",
+				evt.Text, evt.Level, want.text, want.level)
+		}
+	}
+}
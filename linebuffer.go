@@ -0,0 +1,149 @@
+package raven
+
+import (
+	"bytes"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// lineBufferDelay is how long LineBuffer waits for continuation lines
+const lineBufferDelay = 100 * time.Millisecond
+
+// LineBuffer is an io.Writer which reassembles logical log entries written
+// line by line before sending them to Client as a single message. This is
+// useful when Client is used as output of code which writes multi-line
+// entries, such as stack traces, with multiple Write calls.
+//
+// By default LineBuffer treats empty lines, lines starting with a space or a
+// tab, and unindented lines of goroutine stack traces (such as "goroutine 1
+// [running]:" or "main.main()") as continuation of the previous entry, any
+// other line starts a new entry. Use NewLineBufferPattern to recognize entries
+// by their prefix instead. Entry is sent when
+// a new entry starts, when there were no writes for 100ms (as measured by
+// Client Clock, see WithClock), or on Flush call, so messages are delayed by
+// up to 100ms. Call Close when LineBuffer is no longer used to send pending
+// entry and stop waiting for continuation lines. LineBuffer is safe for
+// concurrent use.
+type LineBuffer struct {
+	c       *Client
+	start   *regexp.Regexp // if set, matches lines starting new entry
+	stop    chan struct{}  // closed by Close
+	mu      sync.Mutex
+	buf     []byte    // pending entry
+	flushAt time.Time // when pending entry is sent if there are no writes
+	waiting bool      // whether goroutine waiting for flushAt is running
+	closed  bool
+}
+
+// NewLineBuffer returns LineBuffer sending messages to c.
+func NewLineBuffer(c *Client) *LineBuffer {
+	return &LineBuffer{c: c, stop: make(chan struct{})}
+}
+
+// NewLineBufferPattern returns LineBuffer sending messages to c which starts
+// new entry only on lines matching entryStart, all other lines are treated as
+// continuation of the previous entry. Pattern usually matches a prefix written
+// by logger, i.e. `^\d{4}/\d\d/\d\d ` for log.LstdFlags timestamp.
+func NewLineBufferPattern(c *Client, entryStart *regexp.Regexp) *LineBuffer {
+	b := NewLineBuffer(c)
+	b.start = entryStart
+	return b
+}
+
+// Write implements io.Writer interface. It never returns an error. Entries
+// written after Close are sent without waiting for continuation lines.
+func (b *LineBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for data := p; len(data) > 0; {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+		data = data[len(line):]
+		if n := len(b.buf); n > 0 && b.buf[n-1] == '\n' && b.entryStart(line) {
+			b.flush()
+		}
+		b.buf = append(b.buf, line...)
+	}
+	switch {
+	case len(b.buf) == 0:
+	case b.closed:
+		b.flush()
+	default:
+		b.flushAt = b.c.now().Add(lineBufferDelay)
+		if !b.waiting {
+			b.waiting = true
+			go b.wait()
+		}
+	}
+	return len(p), nil
+}
+
+// wait sends pending entry once there were no writes for lineBufferDelay, or
+// returns when LineBuffer is closed
+func (b *LineBuffer) wait() {
+	clock := b.c.getClock()
+	for {
+		b.mu.Lock()
+		d := b.flushAt.Sub(clock.Now())
+		if d <= 0 || b.closed {
+			if !b.closed {
+				b.flush()
+			}
+			b.waiting = false
+			b.mu.Unlock()
+			return
+		}
+		b.mu.Unlock()
+		select {
+		case <-clock.After(d):
+		case <-b.stop:
+		}
+	}
+}
+
+// Flush sends pending entry to Client, if there is any.
+func (b *LineBuffer) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flush()
+}
+
+// Close sends pending entry to Client, if there is any, and stops waiting
+// for continuation lines. It is safe to call Close multiple times.
+func (b *LineBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.stop)
+	}
+	b.flush()
+	return nil
+}
+
+// goStackLine matches unindented lines of goroutine stack traces as printed by
+// runtime/debug.Stack and on panics
+var goStackLine = regexp.MustCompile(`^(goroutine \d+ \[.*\]:|created by .+|[\w./-]+\.\S*\(.*\))\r?\n?$`)
+
+// entryStart reports whether line starts a new entry
+func (b *LineBuffer) entryStart(line []byte) bool {
+	if b.start != nil {
+		return b.start.Match(line)
+	}
+	switch line[0] {
+	case ' ', '\t', '\r', '\n':
+		return false
+	}
+	return !goStackLine.Match(line)
+}
+
+func (b *LineBuffer) flush() {
+	if len(b.buf) == 0 {
+		return
+	}
+	b.c.Write(b.buf)
+	b.buf = b.buf[:0]
+}
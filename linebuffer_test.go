@@ -0,0 +1,112 @@
+package raven
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artyom/raven/ravenutil"
+)
+
+func TestLineBuffer(t *testing.T) {
+	clock := new(ravenutil.ManualClock)
+	c := newTestClient(t, WithClock(clock))
+	text := func() string { t.Helper(); return queuedText(t, c) }
+	b := NewLineBuffer(c)
+	fmt.Fprintln(b, "first entry:")
+	fmt.Fprintln(b, "\tcontinuation")
+	fmt.Fprint(b, "second ")
+	fmt.Fprintln(b, "entry")
+	if n := len(c.messages); n != 1 {
+		t.Fatalf("wrong number of queued messages: got %d, want 1", n)
+	}
+	if got, want := text(), "first entry:\n\tcontinuation\n"; got != want {
+		t.Fatalf("wrong message: got %q, want %q", got, want)
+	}
+	// second entry is flushed by timer; its goroutine may start waiting
+	// after clock is advanced, so keep advancing it until entry is sent
+	for len(c.messages) == 0 {
+		clock.Advance(lineBufferDelay)
+		runtime.Gosched()
+	}
+	if got, want := text(), "second entry\n"; got != want {
+		t.Fatalf("wrong message: got %q, want %q", got, want)
+	}
+	fmt.Fprintln(b, "third entry")
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.messages); n != 1 {
+		t.Fatalf("pending entry not sent on Close: %d messages queued", n)
+	}
+	if got, want := text(), "third entry\n"; got != want {
+		t.Fatalf("wrong message: got %q, want %q", got, want)
+	}
+	fmt.Fprintln(b, "after close")
+	if got, want := text(), "after close\n"; got != want {
+		t.Fatalf("wrong message: got %q, want %q", got, want)
+	}
+}
+
+func TestLineBuffer_goroutineStack(t *testing.T) {
+	c := newTestClient(t)
+	b := NewLineBuffer(c)
+	stack := debug.Stack()
+	fmt.Fprintln(b, "recovered from panic: boom")
+	for _, line := range strings.SplitAfter(string(stack), "\n") {
+		fmt.Fprint(b, line)
+	}
+	fmt.Fprintln(b)
+	fmt.Fprintln(b, "next entry")
+	b.Close()
+	if n := len(c.messages); n != 2 {
+		t.Fatalf("wrong number of queued messages: got %d, want 2", n)
+	}
+	want := "recovered from panic: boom\n" + string(stack) + "\n"
+	if got := queuedText(t, c); got != want {
+		t.Fatalf("wrong message: got %q, want %q", got, want)
+	}
+	if got, want := queuedText(t, c), "next entry\n"; got != want {
+		t.Fatalf("wrong message: got %q, want %q", got, want)
+	}
+}
+
+func TestNewLineBufferPattern(t *testing.T) {
+	c := newTestClient(t)
+	b := NewLineBufferPattern(c, regexp.MustCompile(`^\d{4}/\d\d/\d\d `))
+	fmt.Fprintln(b, "2018/08/25 10:00:00 first entry")
+	fmt.Fprintln(b, "unindented continuation")
+	fmt.Fprintln(b, "2018/08/25 10:00:01 second entry")
+	b.Close()
+	for _, want := range []string{
+		"2018/08/25 10:00:00 first entry\nunindented continuation\n",
+		"2018/08/25 10:00:01 second entry\n",
+	} {
+		if got := queuedText(t, c); got != want {
+			t.Fatalf("wrong message: got %q, want %q", got, want)
+		}
+	}
+}
+
+// queuedText returns text of the next message queued by c
+func queuedText(t *testing.T, c *Client) string {
+	t.Helper()
+	select {
+	case msg := <-c.messages:
+		var evt struct {
+			Text string `json:"message"`
+		}
+		if err := json.Unmarshal(msg.payload, &evt); err != nil {
+			t.Fatal(err)
+		}
+		return evt.Text
+	case <-time.After(time.Second):
+		t.Fatal("message not queued")
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package raven
+
+import (
+	"encoding/json"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// memStatsInterval is how often memory statistics attached to messages by
+// Client configured with WithMemStats are refreshed.
+const memStatsInterval = 10 * time.Second
+
+// WithMemStats configures Client to attach a subset of runtime.MemStats
+// (allocated and in-use heap bytes, memory obtained from OS, number of
+// completed GC cycles and total GC pause time) to every message as a
+// "memory" context.
+//
+// Reading memory statistics stops the world, so it is not done for every
+// message: statistics are cached process-wide and refreshed at most once per
+// 10 seconds, when a message is logged. As a result, reported values may be up
+// to 10 seconds stale; "read_at" field holds the time they were read. Still,
+// an occasional stop-the-world pause is added to logging calls, so enable
+// this only if such pauses are acceptable for the program.
+func WithMemStats(enable bool) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.memStats = enable
+		return c, nil
+	}
+}
+
+var memStatsCache struct {
+	mu   sync.Mutex
+	at   time.Time // time data was read
+	data json.RawMessage
+}
+
+// memStats returns JSON-encoded subset of runtime.MemStats, refreshing cached
+// value if it's older than memStatsInterval at time now.
+func memStats(now time.Time) json.RawMessage {
+	memStatsCache.mu.Lock()
+	defer memStatsCache.mu.Unlock()
+	if age := now.Sub(memStatsCache.at); memStatsCache.data != nil &&
+		age >= 0 && age < memStatsInterval {
+		return memStatsCache.data
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	stats := struct {
+		Alloc        uint64    `json:"alloc_bytes"`
+		HeapInuse    uint64    `json:"heap_inuse_bytes"`
+		HeapObjects  uint64    `json:"heap_objects"`
+		Sys          uint64    `json:"sys_bytes"`
+		NumGC        uint32    `json:"num_gc"`
+		PauseTotalNs uint64    `json:"gc_pause_total_ns"`
+		ReadAt       time.Time `json:"read_at"`
+	}{
+		Alloc:        ms.Alloc,
+		HeapInuse:    ms.HeapInuse,
+		HeapObjects:  ms.HeapObjects,
+		Sys:          ms.Sys,
+		NumGC:        ms.NumGC,
+		PauseTotalNs: ms.PauseTotalNs,
+		ReadAt:       now.UTC(),
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return memStatsCache.data
+	}
+	memStatsCache.at, memStatsCache.data = now, data
+	return data
+}
+
+// addMemStats adds cached memory statistics to evt contexts.
+func (evt *event) addMemStats() {
+	contexts := make(map[string]json.RawMessage, len(evt.Contexts)+1)
+	for k, v := range evt.Contexts {
+		contexts[k] = v
+	}
+	contexts["memory"] = memStats(evt.ts)
+	evt.Contexts = contexts
+}
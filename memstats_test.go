@@ -0,0 +1,39 @@
+package raven
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWithMemStats(t *testing.T) {
+	c := &Client{
+		contexts: map[string]json.RawMessage{"app": json.RawMessage(`{}`)},
+		memStats: true,
+	}
+	evt := newEvent("text", "", nil, c)
+	var stats struct {
+		Alloc  uint64    `json:"alloc_bytes"`
+		ReadAt time.Time `json:"read_at"`
+	}
+	if err := json.Unmarshal(evt.Contexts["memory"], &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Alloc == 0 || stats.ReadAt.IsZero() {
+		t.Fatalf("memory context is not filled: %s", evt.Contexts["memory"])
+	}
+	if _, ok := c.contexts["memory"]; ok {
+		t.Fatal("memory context was added to client contexts")
+	}
+}
+
+func TestMemStats_cached(t *testing.T) {
+	now := time.Now().Add(time.Hour)
+	first := memStats(now)
+	if got := memStats(now.Add(memStatsInterval / 2)); string(got) != string(first) {
+		t.Errorf("memory statistics refreshed before interval passed")
+	}
+	if got := memStats(now.Add(memStatsInterval)); string(got) == string(first) {
+		t.Errorf("memory statistics not refreshed after interval passed")
+	}
+}
@@ -2,108 +2,532 @@ package raven
 
 import (
 	"bytes"
+	"crypto/md5"
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/pkg/errors"
 )
 
 // message is a queued item to be sent to Sentry API
 type message struct {
-	text    string // used only if send failed to log along with error
-	ts      time.Time
-	gzipped bool   // whether payload is gzipped
-	payload []byte // json-encoded data acceptable by Sentry API
+	text     string // used only if send failed to log along with error
+	ts       time.Time
+	level    Severity // event level, used for sampling
+	gzipped  bool     // whether payload is gzipped
+	envelope bool     // whether payload is an envelope, not a plain event
+	payload  []byte   // json-encoded data acceptable by Sentry API
+
+	fingerprint string // event grouping key, set for fingerprint sampling
+	ignored     bool   // if set, message is discarded by push
+
+	result chan<- error // optional, receives message delivery result
+
+	created  time.Time // time message was created, used for requeue
+	attempts int       // number of failed delivery attempts
+	requests int       // number of API requests made to deliver message
+
+	spoolFile string // name of the spool file message was loaded from
+
+	// if set, message is not sent, but apply is called by the goroutine
+	// processing queue with Client running this goroutine
+	apply func(*Client)
+}
+
+// done reports message delivery result to the channel tracking it, if any
+func (m *message) done(err error) {
+	if m.result != nil {
+		m.result <- err
+	}
+}
+
+// newMessage returns new message created from given arguments, see newEvent
+// for details.
+func newMessage(text, format string, vals []interface{}, c *Client) *message {
+	return newEvent(text, format, vals, c).message(c)
 }
 
-// newMessage returns new message created from given arguments. text is a fully
+// newEvent returns new event created from given arguments. text is a fully
 // formatted text, the one you'd usually see going to log. format is optional
 // format string used to create text. vals is an optional slice of arguments
-// used to create text. Created message does not retain references to vals, so
-// it's safe to modify them after message is created. By default message has
-// "info" severity assigned, if vals contain non-nil error value, then message
-// severity set to "error" and error information is added to message.
-func newMessage(text, format string, vals []interface{}, c *Client) *message {
-	msg := &message{
-		text: text,
-		ts:   time.Now().UTC(),
+// used to create text. Created event does not retain references to vals, so
+// it's safe to modify them after event is created. By default event has
+// "info" severity assigned, if vals contain non-nil error value, then event
+// severity set to "error" and error information is added to event.
+func newEvent(text, format string, vals []interface{}, c *Client) *event {
+	var sanitized bool
+	if s, ok := sanitize(text); ok {
+		text, sanitized = s, true
 	}
 	evt := &event{
-		ID:        randomID(),
-		Text:      text,
-		Timestamp: msg.ts.Format(sentryTimeFormat),
-		Level:     levelInfo,
-		Platform:  "go",
+		ID:       c.eventID(),
+		Text:     text,
+		Level:    LevelInfo,
+		Platform: "go",
 	}
+	evt.setTime(c.now())
 	if c != nil {
+		evt.marshal = c.marshalExtra
 		evt.Tags = c.tags
+		if len(c.defaultTags) > 0 {
+			evt.Tags = mergeTags(c.defaultTags, c.tags)
+		}
 		evt.Hostname = c.hostname
+		evt.Environment = c.environment
+		evt.Release = c.release
+		if c.platform != "" {
+			evt.Platform = c.platform
+		}
 		evt.Request = c.httpReq
-		evt.Extra = c.extra
+		evt.Transaction = c.transaction
+		if c.transaction != "" && c.txSource != "" {
+			evt.TransactionInfo = &transactionInfo{Source: c.txSource}
+		}
+		evt.Extra, evt.extraFields = c.extra, c.extraFields
+		evt.Contexts = c.contexts
+		evt.Measurements = c.measures
+		evt.Breadcrumbs = c.breadcrumbs()
+		if c.memStats {
+			evt.addMemStats()
+		}
+		evt.Modules = c.modules
+		evt.DebugMeta = c.debugImages
+		evt.attachments = c.attachments
+		if c.uptime && !c.newAt.IsZero() {
+			uptime := map[string]interface{}{
+				"uptime_seconds": int64(evt.ts.Sub(c.newAt) / time.Second),
+			}
+			if err := evt.mergeExtra(uptime); err != nil && c.log != nil {
+				c.log.Printf("raven failed to encode extra data: %v", err)
+			}
+		}
+		if !c.startTime.IsZero() {
+			elapsed := map[string]interface{}{
+				"duration_ms": evt.ts.Sub(c.startTime).Milliseconds(),
+			}
+			if err := evt.mergeExtra(elapsed); err != nil && c.log != nil {
+				c.log.Printf("raven failed to encode extra data: %v", err)
+			}
+		}
 	}
-	if format != "" && len(vals) > 0 {
+	switch {
+	case format != "" && len(vals) > 0:
 		evt.Details = &details{Format: format, Text: text}
+	case c != nil && c.alwaysDetails && len(vals) > 0:
+		evt.Details = &details{Format: text, Text: text}
 	}
 	var errs []error
 	for _, v := range vals {
 		if evt.Details != nil {
-			evt.Details.Params = append(evt.Details.Params,
-				fmt.Sprint(v))
+			p := fmt.Sprint(v)
+			if s, ok := sanitize(p); ok {
+				p, sanitized = s, true
+			}
+			evt.Details.Params = append(evt.Details.Params, p)
 		}
 		switch err := v.(type) {
 		case error:
 			if err != nil {
-				errs = append(errs, err)
-				evt.Level = levelError
+				errs = appendErrors(errs, err)
+				evt.Level = LevelError
 			}
 		}
 	}
 	if len(errs) > 0 {
-		if e, ok := errors.Cause(errs[0]).(stackTracer); ok {
-			if st := e.StackTrace(); len(st) > 0 {
-				evt.Culprit = fmt.Sprintf("%n", st[0])
+		if frames := errorFrames(errs[0]); len(frames) > 0 {
+			evt.Culprit = frames[0].Func
+		}
+	}
+	if evt.Culprit == "" {
+		evt.Culprit = callerCulprit()
+	}
+	for i, err := range errs {
+		if i == c.maxExceptions() {
+			omitted := map[string]interface{}{"exceptions_omitted": len(errs) - i}
+			if err := evt.mergeExtra(omitted); err != nil && c != nil && c.log != nil {
+				c.log.Printf("raven failed to encode extra data: %v", err)
+			}
+			break
+		}
+		evt.Exceptions = append(evt.Exceptions, ravenException{err: err})
+	}
+	if len(evt.Exceptions) > 0 && c != nil {
+		evt.Exceptions[0].vars = c.frameVars
+	}
+	evt.ignored = c.ignored(errs)
+	if level, ok := c.errorLevel(errs); ok {
+		evt.Level = level
+	}
+	if tags := errorTags(errs); len(tags) > 0 {
+		evt.Tags = mergeTags(evt.Tags, tags)
+	}
+	if fields := errorFields(errs); len(fields) > 0 {
+		if err := evt.mergeExtra(fields); err != nil && c != nil && c.log != nil {
+			c.log.Printf("raven failed to encode error fields: %v", err)
+		}
+	}
+	if evt.Details != nil {
+		if s, ok := sanitize(evt.Details.Format); ok {
+			evt.Details.Format, sanitized = s, true
+		}
+	}
+	if c != nil && c.formatFingerprint && formatHasText(format) {
+		fp, _ := sanitize(format)
+		if len(evt.Exceptions) > 0 {
+			// keep errors logged with the same format apart
+			evt.Fingerprint = []string{"{{ default }}", fp}
+		} else {
+			evt.Fingerprint = []string{fp}
+		}
+	}
+	if sanitized && c != nil && c.log != nil {
+		c.log.Printf("raven replaced invalid characters in message %q", text)
+	}
+	if evt.Text == "" && len(evt.Exceptions) == 0 {
+		// Sentry rejects events without both message and exception
+		evt.Text = emptyMessageText
+		if c != nil && c.log != nil {
+			c.log.Printf("raven got event %s without message and errors, reporting it as %q",
+				evt.ID, emptyMessageText)
+		}
+	}
+	return evt
+}
+
+// maxErrorText is the max. number of message text characters included into
+// errors about this message
+const maxErrorText = 100
+
+// truncateText returns s truncated to at most n characters, with ellipsis
+// appended if it was truncated
+func truncateText(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i] + "…"
+		}
+		n--
+	}
+	return s
+}
+
+// emptyMessageText is reported as message text of events which have neither
+// text nor errors.
+const emptyMessageText = "(empty message)"
+
+// formatHasText reports whether fmt format string has letters outside of
+// formatting verbs, so that it describes the message and not only how its
+// arguments are printed, as "%v" or "%s: %v" do.
+func formatHasText(format string) bool {
+	for i := 0; i < len(format); i++ {
+		if format[i] == '%' {
+			// skip flags, width, precision and argument index up to the verb
+			for i++; i < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[i]) >= 0; i++ {
 			}
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(format[i:])
+		if unicode.IsLetter(r) {
+			return true
+		}
+		i += size - 1
+	}
+	return false
+}
+
+// sanitize replaces invalid UTF-8 sequences in s with U+FFFD and removes
+// control characters other than tab and newline. It returns modified string
+// and true if s was changed, otherwise it returns s and false.
+func sanitize(s string) (string, bool) {
+	if utf8.ValidString(s) && strings.IndexFunc(s, isBadControl) == -1 {
+		return s, false
+	}
+	return strings.Map(func(r rune) rune {
+		if isBadControl(r) {
+			return -1
 		}
+		return r
+	}, s), true
+}
+
+// isBadControl reports whether r is a control character which should not be
+// sent to Sentry
+func isBadControl(r rune) bool {
+	return unicode.IsControl(r) && r != '\t' && r != '\n'
+}
+
+// LogFielder can be implemented by errors carrying structured data. If any
+// error logged by Client or any error it wraps implements this interface,
+// fields it returns are sent as event extra data. If several errors provide
+// the same field, value of the outermost error is used.
+type LogFielder interface {
+	LogFields() map[string]interface{}
+}
+
+// errorFields returns fields of all errors in errs and errors they wrap which
+// implement LogFielder interface
+func errorFields(errs []error) map[string]interface{} {
+	var out map[string]interface{}
+	for _, err := range errs {
+		walkErrors(err, func(err error) {
+			e, ok := err.(LogFielder)
+			if !ok {
+				return
+			}
+			for k, v := range e.LogFields() {
+				if out == nil {
+					out = make(map[string]interface{})
+				}
+				if _, ok := out[k]; !ok {
+					out[k] = v
+				}
+			}
+		})
+	}
+	return out
+}
+
+// SentryTagger can be implemented by errors carrying their own Sentry
+// metadata, i.e. HTTP client error providing response status code. If any
+// error logged by Client or any error it wraps implements this interface, tags
+// it returns are added to the event, overriding Client and sublogger tags
+// with the same names. If several errors provide the same tag, value of the
+// outermost error is used.
+type SentryTagger interface {
+	SentryTags() map[string]string
+}
+
+// errorTags returns tags of all errors in errs and errors they wrap which
+// implement SentryTagger interface
+func errorTags(errs []error) map[string]string {
+	var out map[string]string
+	for _, err := range errs {
+		walkErrors(err, func(err error) {
+			e, ok := err.(SentryTagger)
+			if !ok {
+				return
+			}
+			for k, v := range e.SentryTags() {
+				if out == nil {
+					out = make(map[string]string)
+				}
+				if _, ok := out[k]; !ok {
+					out[k] = v
+				}
+			}
+		})
+	}
+	return out
+}
+
+// errorLevel returns level mapped by function configured with
+// WithLevelFromError from the first error in errs, or errors they wrap, it
+// matches
+func (c *Client) errorLevel(errs []error) (level Severity, ok bool) {
+	if c == nil || c.levelFromError == nil {
+		return 0, false
 	}
 	for _, err := range errs {
-		evt.Exceptions = append(evt.Exceptions, ravenException{err})
+		walkErrors(err, func(err error) {
+			if !ok {
+				level, ok = c.levelFromError(err)
+				ok = ok && level.valid()
+			}
+		})
+		if ok {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
+// walkErrors calls fn for err and every error it wraps, following both
+// Unwrap and Cause methods
+func walkErrors(err error, fn func(error)) {
+	for err != nil {
+		fn(err)
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		case interface{ Cause() error }:
+			err = e.Cause()
+		default:
+			return
+		}
+	}
+}
+
+// appendErrors appends err to errs and returns the resulting slice. If err
+// holds multiple errors (i.e. created with errors.Join), each of them is
+// appended separately.
+func appendErrors(errs []error, err error) []error {
+	me, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return append(errs, err)
+	}
+	for _, err := range me.Unwrap() {
+		if err != nil {
+			errs = appendErrors(errs, err)
+		}
+	}
+	return errs
+}
+
+// addGoroutineDump adds number of running goroutines as a "goroutines" tag
+// and stack traces of all goroutines as an attachment to event. Stack traces
+// dump is truncated to maxAttachmentSize.
+func (evt *event) addGoroutineDump() {
+	evt.Tags = mergeTags(evt.Tags, map[string]string{
+		"goroutines": strconv.Itoa(runtime.NumGoroutine()),
+	})
+	buf := make([]byte, maxAttachmentSize)
+	buf = buf[:runtime.Stack(buf, true)]
+	attachments := make([]attachment, len(evt.attachments), len(evt.attachments)+1)
+	copy(attachments, evt.attachments)
+	evt.attachments = append(attachments, attachment{name: "goroutines.txt", data: buf})
+}
+
+// setTime sets event timestamp to t
+func (evt *event) setTime(t time.Time) {
+	evt.ts = t.UTC()
+	evt.Timestamp = evt.ts.Format(sentryTimeFormat)
+}
+
+// message returns new message with json-encoded event as its payload. If
+// event cannot be encoded, error is logged to c.log and payload is created
+// from a minimal event holding only message text and severity.
+func (evt *event) message(c *Client) *message {
+	msg := &message{
+		text:    evt.Text,
+		ts:      evt.ts,
+		level:   evt.Level,
+		created: c.now(),
 	}
-	if data, err := json.Marshal(evt); err == nil {
+	if evt.ignored || c.belowMinLevel(evt.Level) {
+		msg.ignored = true
+		return msg
+	}
+	if evt.Level == LevelFatal && c != nil && c.goroutineDump {
+		evt.addGoroutineDump()
+	}
+	if evt.Level == LevelFatal && c != nil && c.threadDump {
+		evt.addThreads()
+	}
+	if c != nil && c.fingerprintFunc != nil {
+		if fp := c.fingerprintFunc(evt.export()); len(fp) > 0 {
+			evt.Fingerprint = append([]string(nil), fp...)
+		}
+	}
+	data, err := c.encode(evt)
+	if err != nil {
+		if c != nil && c.log != nil {
+			c.log.Printf("raven failed to encode event for message %q: %v", evt.Text, err)
+		}
+		data, err = json.Marshal(&event{
+			ID:        evt.ID,
+			Text:      evt.Text,
+			Timestamp: evt.Timestamp,
+			Level:     evt.Level,
+			Platform:  evt.Platform,
+		})
+	}
+	if err == nil {
 		msg.payload = data
 	}
+	if len(msg.payload) > 0 && len(evt.attachments) > 0 {
+		msg.payload = envelope(evt.ID, msg.payload, evt.attachments)
+		msg.envelope = true
+	}
+	if c != nil && c.sampling == SampleByFingerprint {
+		msg.fingerprint = evt.fingerprint()
+	}
+	if len(msg.payload) > 0 && c != nil && c.gzip && !c.noGzip.Load() {
+		if err := msg.compress(c.gzipLevel); err != nil && c.log != nil {
+			c.log.Printf("raven failed to compress message %q: %v", msg.text, err)
+		}
+	}
 	return msg
 }
 
 func (c *Client) send(hc *http.Client, msg *message) error {
 	if len(msg.payload) == 0 {
-		return errors.New("empty message payload")
+		return errors.Errorf("empty payload of message %q", truncateText(msg.text, maxErrorText))
+	}
+	c.mu.Lock()
+	endpoint, auth := c.apiURL, c.auth
+	c.mu.Unlock()
+	if endpoint == "" && c.localSink != nil {
+		return c.writeLocal(msg)
 	}
 	var err error
 	var doSleep bool
 	for wait := 200 * time.Millisecond; wait < 3*time.Second; wait *= 2 {
 		switch {
 		case doSleep:
-			time.Sleep(wait)
+			c.getClock().Sleep(wait)
 		default:
 			doSleep = true
 		}
-		req, err := http.NewRequest(http.MethodPost, c.apiURL, bytes.NewReader(msg.payload))
-		if err != nil {
+		apiURL, contentType := endpoint, "application/json"
+		if c.contentType != "" {
+			contentType = c.contentType
+		}
+		if msg.envelope {
+			apiURL, contentType = envelopeURL(endpoint), envelopeContentType
+		}
+		var req *http.Request
+		if req, err = http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(msg.payload)); err != nil {
 			return err
 		}
 		req.Header.Add("User-Agent", userAgent)
-		req.Header.Add("Content-Type", "application/json")
-		req.Header.Add(authHeader, "Sentry sentry_version=7")
-		req.Header.Add(authHeader, fmt.Sprintf("sentry_timestamp=%d", msg.ts.Unix()))
-		for _, h := range c.auth {
-			req.Header.Add(authHeader, h)
+		req.Header.Add("Content-Type", contentType)
+		if msg.gzipped {
+			req.Header.Add("Content-Encoding", "gzip")
+		}
+		authParts := append([]string{
+			fmt.Sprintf("Sentry sentry_version=%d", c.protocolVersion()),
+			fmt.Sprintf("sentry_timestamp=%d", c.authTime(msg).Unix()),
+		}, auth...)
+		if c.singleAuth {
+			req.Header.Set(authHeader, strings.Join(authParts, ", "))
+		} else {
+			for _, h := range authParts {
+				req.Header.Add(authHeader, h)
+			}
+		}
+		if c.signer != nil {
+			if name, value := c.signer(msg.payload); name != "" {
+				req.Header.Set(name, value)
+			}
 		}
-		if err = doRequest(hc, req); err == nil {
+		var status int
+		if status, err = doRequest(hc, req); err == nil {
 			return nil
 		}
+		if err == errThrottled { // backoff is handled by loopSend
+			return err
+		}
+		if msg.gzipped && (status == http.StatusBadRequest || status == http.StatusUnsupportedMediaType) {
+			// request may be rejected because of compression, retry
+			// it uncompressed; if it succeeds, stop compressing
+			if msg.decompress() != nil {
+				return err
+			}
+			if err = c.send(hc, msg); err == nil {
+				c.noGzip.Store(true)
+				if c.log != nil {
+					c.log.Print("raven disables compression as Sentry API rejected compressed request")
+				}
+			}
+			return err
+		}
 		if e, ok := err.(temporary); ok && e.Temporary() {
 			continue
 		}
@@ -112,43 +536,50 @@ func (c *Client) send(hc *http.Client, msg *message) error {
 	return err
 }
 
-func doRequest(hc *http.Client, req *http.Request) error {
+// doRequest sends req and converts response status to error, it returns
+// response status code along with it
+func doRequest(hc *http.Client, req *http.Request) (int, error) {
 	resp, err := hc.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
 	switch x := resp.StatusCode; {
 	case x == http.StatusOK:
-		return nil
+		return x, nil
 	case x == http.StatusTooManyRequests:
-		return errThrottled
+		return x, errThrottled
 	case http.StatusBadRequest <= x && x < http.StatusInternalServerError:
 		errText := "Sentry API request error: "
 		if reason := resp.Header.Get(sentryErrorHeader); reason != "" {
-			return temporaryError(errText + reason)
+			return x, permanentError(errText + reason)
 		} else {
-			return temporaryError(errText + resp.Status)
+			return x, permanentError(errText + resp.Status)
 		}
 	case x >= http.StatusInternalServerError:
-		return permanentError("Sentry API server error: " + resp.Status)
+		return x, temporaryError("Sentry API server error: " + resp.Status)
 	}
-	return nil
+	return resp.StatusCode, nil
 }
 
+// temporary is implemented by errors which may go away if request is retried
 type temporary interface {
 	Temporary() bool
 }
 
+// permanentError is an error which is not worth retrying, i.e. Sentry API
+// rejected request as malformed (4xx status)
 type permanentError string
 
 func (e permanentError) Error() string   { return string(e) }
-func (e permanentError) Temporary() bool { return true }
+func (e permanentError) Temporary() bool { return false }
 
+// temporaryError is an error which may go away on retry, i.e. Sentry API
+// server failure (5xx status)
 type temporaryError string
 
 func (e temporaryError) Error() string   { return string(e) }
-func (e temporaryError) Temporary() bool { return false }
+func (e temporaryError) Temporary() bool { return true }
 
 var errThrottled = temporaryError("throttle required, Sentry API overloaded")
 
@@ -158,8 +589,59 @@ const (
 	userAgent         = "github.com/artyom/raven"
 )
 
+const defaultProtocolVersion = 7
+
 const maxFrames = 3 // max. number of frames to include per single error
 
+const defaultMaxExceptions = 10 // default max. number of exceptions per event
+
+// maxExceptions returns maximum number of exceptions sent with event
+func (c *Client) maxExceptions() int {
+	if c == nil || c.maxExcs == 0 {
+		return defaultMaxExceptions
+	}
+	return c.maxExcs
+}
+
+// authTime returns time reported in authentication header of the next API
+// request for msg: event time for the first request, current time for
+// retries, so that Sentry does not reject retried requests as stale
+func (c *Client) authTime(msg *message) time.Time {
+	msg.requests++
+	if msg.requests == 1 {
+		return msg.ts
+	}
+	return c.now()
+}
+
+// protocolVersion returns Sentry protocol version reported by Client
+func (c *Client) protocolVersion() int {
+	if c.version == 0 {
+		return defaultProtocolVersion
+	}
+	return c.version
+}
+
+// eventID returns new event ID, generated by function configured with
+// WithIDGenerator or random one
+func (c *Client) eventID() string {
+	if c == nil || c.newID == nil {
+		return randomID()
+	}
+	return normalizeID(c.newID())
+}
+
+// normalizeID returns id converted to the format of Sentry event ID: 32
+// lowercase hex characters. Hex string with dashes (like UUID) is returned
+// with dashes removed, any other string is hashed.
+func normalizeID(id string) string {
+	s := strings.ToLower(strings.Replace(id, "-", "", -1))
+	if len(s) == 32 && strings.Trim(s, "0123456789abcdef") == "" {
+		return s
+	}
+	return fmt.Sprintf("%x", md5.Sum([]byte(id)))
+}
+
 func randomID() string {
 	b := make([]byte, 16) // TODO: pool this
 	if _, err := rand.Read(b); err != nil {
@@ -1,9 +1,23 @@
 package raven
 
 import (
+	"bytes"
 	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/artyom/raven/ravenutil"
 	"github.com/pkg/errors"
 )
 
@@ -34,6 +48,9 @@ func TestNewEvent(t *testing.T) {
 		t.Fatalf("wrong number of exceptions in event: want 1, got %d", l)
 	}
 	exc := unp.Exceptions[0]
+	if m := exc.Mechanism; m == nil || !m.Handled {
+		t.Fatalf("wrong exception mechanism: %+v", m)
+	}
 	if exc.Trace == nil {
 		t.Fatalf("no trace attached to first exception")
 	}
@@ -44,6 +61,157 @@ func TestNewEvent(t *testing.T) {
 		t.Fatalf("wrong function name in first frame of first exception: want %q, got %q",
 			funcName, fr.Function)
 	}
+	fr := exc.Trace.Frames[0]
+	if want := "github.com/artyom/raven"; fr.Module != want {
+		t.Fatalf("wrong module in first frame: want %q, got %q", want, fr.Module)
+	}
+	if !filepath.IsAbs(fr.AbsPath) || filepath.Base(fr.AbsPath) != fr.File {
+		t.Fatalf("wrong absolute path in first frame: %q (file %q)", fr.AbsPath, fr.File)
+	}
+}
+
+func TestNewEvent_joinedErrors(t *testing.T) {
+	err := stderrors.Join(failFoo(), stderrors.New("plain"), failFoo())
+	msg := newMessage("joined errors", "", []interface{}{err}, nil)
+	var unp ravenEventExamine
+	if err := json.Unmarshal(msg.payload, &unp); err != nil {
+		t.Fatal(err)
+	}
+	if l := len(unp.Exceptions); l != 3 {
+		t.Fatalf("wrong number of exceptions in event: want 3, got %d", l)
+	}
+	for i, exc := range unp.Exceptions {
+		switch hasTrace := exc.Trace != nil; {
+		case i == 1 && hasTrace:
+			t.Errorf("exception %d should not have stacktrace", i)
+		case i != 1 && !hasTrace:
+			t.Errorf("exception %d should have stacktrace", i)
+		}
+	}
+	if got, want := unp.Exceptions[1].Text, "plain"; got != want {
+		t.Fatalf("wrong second exception value: got %q, want %q", got, want)
+	}
+	if got, want := unp.Culprit, "failFoo"; got != want {
+		t.Fatalf("wrong culprit field in event: want %q, got %q", want, got)
+	}
+}
+
+func TestNewEvent_maxExceptions(t *testing.T) {
+	err := stderrors.Join(stderrors.New("foo"), stderrors.New("bar"), stderrors.New("baz"))
+	c := &Client{maxExcs: 2}
+	evt := newEvent("joined errors", "", []interface{}{err}, c)
+	if l := len(evt.Exceptions); l != 2 {
+		t.Fatalf("wrong number of exceptions: got %d, want 2", l)
+	}
+	if want := `{"exceptions_omitted":1}`; string(evt.Extra) != want {
+		t.Fatalf("wrong extra: got %s, want %s", evt.Extra, want)
+	}
+}
+
+func TestNewEvent_formatFingerprint(t *testing.T) {
+	c := &Client{formatFingerprint: true}
+	evt := newEvent("failed to load user 42", "failed to load user %d", []interface{}{42}, c)
+	if len(evt.Fingerprint) != 1 || evt.Fingerprint[0] != "failed to load user %d" {
+		t.Fatalf("wrong fingerprint: %q", evt.Fingerprint)
+	}
+	if evt := newEvent("plain message", "", nil, c); evt.Fingerprint != nil {
+		t.Fatalf("unexpected fingerprint for message without format: %q", evt.Fingerprint)
+	}
+	for _, format := range []string{"%v", "%s: %+v", "%[1]*.2f%%"} {
+		if evt := newEvent("text", format, nil, c); evt.Fingerprint != nil {
+			t.Errorf("unexpected fingerprint for format %q: %q", format, evt.Fingerprint)
+		}
+	}
+	evt = newEvent("save failed: boom", "save failed: %v", []interface{}{stderrors.New("boom")}, c)
+	if want := []string{"{{ default }}", "save failed: %v"}; !reflect.DeepEqual(evt.Fingerprint, want) {
+		t.Fatalf("wrong fingerprint for message with error: got %q, want %q", evt.Fingerprint, want)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	testCases := []struct {
+		input, want string
+		changed     bool
+	}{
+		{"plain\ttext\n", "plain\ttext\n", false},
+		{"bell\a and nul\x00", "bell and nul", true},
+		{"bad \xff byte", "bad \uFFFD byte", true},
+	}
+	for _, tc := range testCases {
+		got, changed := sanitize(tc.input)
+		if got != tc.want || changed != tc.changed {
+			t.Errorf("sanitize(%q) = %q, %v; want %q, %v",
+				tc.input, got, changed, tc.want, tc.changed)
+		}
+	}
+}
+
+func TestNewEvent_encodeFallback(t *testing.T) {
+	evt := newEvent("bad extra", "", nil, nil)
+	evt.Extra = json.RawMessage("{not json")
+	msg := evt.message(nil)
+	var unp struct {
+		Text  string          `json:"message"`
+		Extra json.RawMessage `json:"extra"`
+	}
+	if err := json.Unmarshal(msg.payload, &unp); err != nil {
+		t.Fatalf("fallback payload is invalid: %v", err)
+	}
+	if unp.Text != "bad extra" || unp.Extra != nil {
+		t.Fatalf("unexpected fallback payload: %s", msg.payload)
+	}
+}
+
+func TestNormalizeID(t *testing.T) {
+	testCases := []struct{ input, want string }{
+		{"0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef"},
+		{"0E2B7C8A-1D3F-4A5B-9C6D-7E8F9A0B1C2D", "0e2b7c8a1d3f4a5b9c6d7e8f9a0b1c2d"},
+		{"req-42", "eaa12ac3c5d9719fc85cd866933059f2"},
+	}
+	for _, tc := range testCases {
+		if got := normalizeID(tc.input); got != tc.want {
+			t.Errorf("normalizeID(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestNewEvent_errorFields(t *testing.T) {
+	inner := fieldsError{errors.New("inner"), map[string]interface{}{"user": 1, "op": "inner"}}
+	outer := fieldsError{errors.Wrap(inner, "outer"), map[string]interface{}{"op": "outer"}}
+	evt := newEvent("message", "", []interface{}{outer}, nil)
+	if got, want := string(evt.Extra), `{"op":"outer","user":1}`; got != want {
+		t.Fatalf("wrong event extra: got %s, want %s", got, want)
+	}
+}
+
+type fieldsError struct {
+	error
+	fields map[string]interface{}
+}
+
+func (e fieldsError) Cause() error                      { return e.error }
+func (e fieldsError) LogFields() map[string]interface{} { return e.fields }
+
+func TestNewEvent_errorTags(t *testing.T) {
+	inner := statusError{errors.New("not found"), 404}
+	c := &Client{tags: map[string]string{"status_code": "client", "app": "test"}}
+	evt := newEvent("message", "", []interface{}{errors.Wrap(inner, "request failed")}, c)
+	want := map[string]string{"status_code": "404", "app": "test"}
+	if len(evt.Tags) != len(want) || evt.Tags["status_code"] != "404" || evt.Tags["app"] != "test" {
+		t.Fatalf("wrong event tags: got %v, want %v", evt.Tags, want)
+	}
+	if c.tags["status_code"] != "client" {
+		t.Fatal("client tags modified")
+	}
+}
+
+type statusError struct {
+	error
+	status int
+}
+
+func (e statusError) SentryTags() map[string]string {
+	return map[string]string{"status_code": strconv.Itoa(e.status)}
 }
 
 func failFoo() error { return errors.New("boom") }
@@ -54,14 +222,337 @@ type ravenEventExamine struct {
 	Culprit    string            `json:"culprit"`
 	Tags       map[string]string `json:"tags,omitempty"`
 	Exceptions []struct {
-		Type  string `json:"type"`
-		Text  string `json:"value"`
+		Type      string `json:"type"`
+		Text      string `json:"value"`
+		Mechanism *struct {
+			Type    string `json:"type"`
+			Handled bool   `json:"handled"`
+		} `json:"mechanism"`
 		Trace *struct {
 			Frames []struct {
 				File     string `json:"filename"`
+				AbsPath  string `json:"abs_path"`
 				Function string `json:"function"`
+				Module   string `json:"module"`
 				Line     int    `json:"lineno"`
+
+				Vars map[string]string `json:"vars"`
 			} `json:"frames"`
 		} `json:"stacktrace,omitempty"`
 	} `json:"exception,omitempty"`
 }
+
+func TestClient_sendRetries(t *testing.T) {
+	testCases := []struct {
+		status   int
+		requests int32
+		fail     bool
+	}{
+		{http.StatusOK, 1, false},
+		{http.StatusBadRequest, 1, true},
+		{http.StatusTooManyRequests, 1, true},
+		{http.StatusServiceUnavailable, 4, true},
+	}
+	for _, tc := range testCases {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(tc.status)
+		}))
+		clock := new(ravenutil.Clock)
+		c := &Client{shared: &shared{apiURL: srv.URL + "/api/1/store/"}, clock: clock}
+		err := c.send(srv.Client(), newMessage("message", "", nil, c))
+		srv.Close()
+		if (err != nil) != tc.fail {
+			t.Errorf("status %d: unexpected send result: %v", tc.status, err)
+		}
+		if n := atomic.LoadInt32(&requests); n != tc.requests {
+			t.Errorf("status %d: wrong number of requests: got %d, want %d",
+				tc.status, n, tc.requests)
+		}
+		if tc.requests > 1 && clock.Slept() == 0 {
+			t.Errorf("status %d: no delay between retries", tc.status)
+		}
+	}
+}
+
+func TestClient_sendGzipFallback(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		var evt ravenEventExamine
+		if err := json.NewDecoder(r.Body).Decode(&evt); err != nil {
+			t.Errorf("uncompressed request body: %v", err)
+		}
+	}))
+	defer srv.Close()
+	c := &Client{shared: &shared{apiURL: srv.URL + "/api/1/store/"}, gzip: true}
+	msg := newMessage("message", "", nil, c)
+	if !msg.gzipped {
+		t.Fatal("message payload is not compressed")
+	}
+	if err := c.send(srv.Client(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("wrong number of requests: got %d, want 2", n)
+	}
+	if !c.noGzip.Load() {
+		t.Fatal("compression not disabled after rejected request")
+	}
+	if msg := newMessage("message", "", nil, c); msg.gzipped {
+		t.Fatal("message compressed after compression was disabled")
+	}
+}
+
+func TestClient_sendGzipNoFallback(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+	c := newTestServerClient(t, srv, WithGzip(true))
+	if err := c.send(srv.Client(), newMessage("message", "", nil, c)); err == nil {
+		t.Fatal("rejected request reported as sent")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("wrong number of requests: got %d, want 1", n)
+	}
+	if c.noGzip.Load() {
+		t.Fatal("compression disabled after request rejected for unrelated reason")
+	}
+}
+
+func TestClient_sendSingleAuthHeader(t *testing.T) {
+	for _, single := range []bool{false, true} {
+		var values []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			values = r.Header["X-Sentry-Auth"]
+		}))
+		c := &Client{
+			shared: &shared{
+				apiURL: srv.URL + "/api/1/store/",
+				auth:   []string{"sentry_key=foo", "sentry_secret=bar"},
+			},
+			singleAuth: single,
+		}
+		err := c.send(srv.Client(), newMessage("message", "", nil, c))
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 4
+		if single {
+			want = 1
+		}
+		if len(values) != want {
+			t.Fatalf("single=%v: got %d header values, want %d: %q", single, len(values), want, values)
+		}
+		if joined := strings.Join(values, ", "); !strings.HasPrefix(joined, "Sentry sentry_version=7, ") ||
+			!strings.HasSuffix(joined, ", sentry_key=foo, sentry_secret=bar") {
+			t.Fatalf("single=%v: wrong header: %q", single, joined)
+		}
+	}
+}
+
+func TestWithProtocolVersion(t *testing.T) {
+	if _, err := WithProtocolVersion(0)(nil); err == nil {
+		t.Fatal("invalid protocol version accepted")
+	}
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("X-Sentry-Auth")
+	}))
+	defer srv.Close()
+	c := newTestServerClient(t, srv, WithProtocolVersion(6))
+	if err := c.send(srv.Client(), newMessage("message", "", nil, c)); err != nil {
+		t.Fatal(err)
+	}
+	if got != "Sentry sentry_version=6" {
+		t.Fatalf("wrong auth header: %q", got)
+	}
+}
+
+func TestClient_sendContentType(t *testing.T) {
+	for _, contentType := range []string{"", "application/json; charset=utf-8"} {
+		var got string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("Content-Type")
+		}))
+		c := &Client{
+			shared:      &shared{apiURL: srv.URL + "/api/1/store/"},
+			contentType: contentType,
+		}
+		err := c.send(srv.Client(), newMessage("message", "", nil, c))
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := contentType
+		if want == "" {
+			want = "application/json"
+		}
+		if got != want {
+			t.Fatalf("wrong Content-Type: got %q, want %q", got, want)
+		}
+	}
+	if _, err := WithContentType(" ")(nil); err == nil {
+		t.Fatal("empty content type accepted")
+	}
+}
+
+func TestNewEvent_defaultTags(t *testing.T) {
+	c := &Client{
+		tags:        map[string]string{"a": "client", "b": "client"},
+		defaultTags: map[string]string{"a": "default", "b": "default", "c": "default"},
+	}
+	l := AttachTags(c, map[string]string{"b": "sublogger"})
+	evt := newEvent("message", "", nil, l.(*Client))
+	want := map[string]string{"a": "client", "b": "sublogger", "c": "default"}
+	if len(evt.Tags) != len(want) {
+		t.Fatalf("wrong tags: got %v, want %v", evt.Tags, want)
+	}
+	for k, v := range want {
+		if evt.Tags[k] != v {
+			t.Fatalf("wrong tags: got %v, want %v", evt.Tags, want)
+		}
+	}
+}
+
+func TestNewEvent_levelFromError(t *testing.T) {
+	errCritical := stderrors.New("critical")
+	c := &Client{
+		levelFromError: func(err error) (Severity, bool) {
+			switch err {
+			case errCritical:
+				return LevelFatal, true
+			case io.EOF:
+				return LevelWarning, true
+			}
+			return 0, false
+		},
+	}
+	for _, tc := range []struct {
+		err  error
+		want Severity
+	}{
+		{fmt.Errorf("wrapped twice: %w", fmt.Errorf("wrapped: %w", errCritical)), LevelFatal},
+		{errors.Wrap(io.EOF, "reading"), LevelWarning},
+		{stderrors.Join(stderrors.New("other"), io.EOF), LevelWarning},
+		{stderrors.New("plain"), LevelError},
+	} {
+		if evt := newEvent("text", "", []interface{}{tc.err}, c); evt.Level != tc.want {
+			t.Errorf("%v: got level %v, want %v", tc.err, evt.Level, tc.want)
+		}
+	}
+}
+
+func TestClient_sendEmptyPayload(t *testing.T) {
+	c := &Client{shared: &shared{apiURL: "http://example.com/api/1/store/"}}
+	text := strings.Repeat("ж", maxErrorText) + "tail"
+	err := c.send(http.DefaultClient, &message{text: text})
+	if err == nil {
+		t.Fatal("message with empty payload sent")
+	}
+	want := strconv.Quote(strings.Repeat("ж", maxErrorText) + "…")
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("error does not contain truncated message text: %v", err)
+	}
+}
+
+func TestNewEvent_empty(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := &Client{log: log.New(buf, "", 0)}
+	evt := newEvent("", "", nil, c)
+	if evt.Text != emptyMessageText {
+		t.Fatalf("wrong text of empty event: %q", evt.Text)
+	}
+	if !strings.Contains(buf.String(), "without message and errors") {
+		t.Fatalf("no warning logged: %q", buf.String())
+	}
+	buf.Reset()
+	evt = newEvent("", "", []interface{}{errors.New("boom")}, c)
+	if evt.Text != "" || buf.Len() != 0 {
+		t.Fatalf("event with error got text %q, log %q", evt.Text, buf.String())
+	}
+}
+
+func TestClient_sendSigned(t *testing.T) {
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get("X-Signature")
+	}))
+	defer srv.Close()
+	c := &Client{
+		shared: &shared{apiURL: srv.URL + "/api/1/store/"},
+		signer: func(payload []byte) (string, string) {
+			return "X-Signature", strconv.Itoa(len(payload))
+		},
+	}
+	msg := newMessage("message", "", nil, c)
+	if err := c.send(srv.Client(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if want := strconv.Itoa(len(msg.payload)); signature != want {
+		t.Fatalf("wrong signature header: got %q, want %q", signature, want)
+	}
+}
+
+func TestClient_sendRetryAuthTimestamp(t *testing.T) {
+	var stamps []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, v := range r.Header["X-Sentry-Auth"] {
+			if strings.HasPrefix(v, "sentry_timestamp=") {
+				stamps = append(stamps, strings.TrimPrefix(v, "sentry_timestamp="))
+			}
+		}
+		if len(stamps) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	clock := new(ravenutil.Clock)
+	c := &Client{shared: &shared{apiURL: srv.URL + "/api/1/store/"}, clock: clock}
+	evt := newEvent("message", "", nil, c)
+	evt.setTime(clock.Now().Add(-time.Hour))
+	msg := evt.message(c)
+	if err := c.send(srv.Client(), msg); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		strconv.FormatInt(msg.ts.Unix(), 10),
+		strconv.FormatInt(clock.Now().Unix(), 10),
+	}
+	if len(stamps) != 2 || stamps[0] != want[0] || stamps[1] != want[1] {
+		t.Fatalf("wrong request timestamps: got %q, want %q", stamps, want)
+	}
+}
+
+func TestWithGoroutineDumpOnFatal(t *testing.T) {
+	c := newTestClient(t, WithGoroutineDumpOnFatal(true))
+	for _, level := range []Severity{LevelError, LevelFatal} {
+		evt := newEvent("message", "", nil, c)
+		evt.Level = level
+		msg := evt.message(c)
+		if level != LevelFatal {
+			if msg.envelope || evt.Tags["goroutines"] != "" {
+				t.Fatalf("goroutines dump added to %v event", level)
+			}
+			continue
+		}
+		if !msg.envelope || len(evt.attachments) != 1 || evt.attachments[0].name != "goroutines.txt" {
+			t.Fatalf("no goroutines dump attached to fatal event: %+v", evt.attachments)
+		}
+		if !bytes.HasPrefix(evt.attachments[0].data, []byte("goroutine ")) {
+			t.Fatalf("wrong goroutines dump: %q", evt.attachments[0].data)
+		}
+		if n, err := strconv.Atoi(evt.Tags["goroutines"]); err != nil || n < 1 {
+			t.Fatalf("wrong goroutines tag: %q", evt.Tags["goroutines"])
+		}
+	}
+}
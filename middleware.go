@@ -0,0 +1,45 @@
+package raven
+
+import "net/http"
+
+// HTTPMiddleware wraps http.Handler so that any panic in its ServeHTTP method
+// is recovered and reported to Sentry as a fatal event with request
+// information and stack trace of panicking goroutine attached. After panic is
+// reported, handler either replies with 500 Internal Server Error status or
+// panics again with the same value, see WithRepanic. Panics with
+// http.ErrAbortHandler value are not reported and always propagated.
+func (c *Client) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			c.reportPanic(r, newPanicError(p, 1))
+			if c != nil && c.repanic {
+				panic(p)
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reportPanic sends fatal event for panic recovered while serving request r
+func (c *Client) reportPanic(r *http.Request, err *panicError) {
+	if c == nil {
+		return
+	}
+	c2 := AttachRequestInfo(c, r).(*Client)
+	text := "panic serving " + r.Method + " " + r.URL.String() + ": " + err.Error()
+	evt := newEvent(text, "", []interface{}{err}, c2)
+	evt.Level = LevelFatal
+	c.push(evt.message(c))
+	if c.forward(LevelFatal) {
+		c.log.Print(text)
+	}
+}
@@ -0,0 +1,147 @@
+package raven
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CapturePanic creates new fatal event from value v returned by recover()
+// and pushes it to outgoing queue. It is meant for code doing its own panic
+// recovery. stack is an optional stack trace of panicking goroutine in the
+// format of runtime/debug.Stack; if it is empty, stack trace of the current
+// goroutine is used, which points to the panic site if CapturePanic is
+// called from a deferred function. Values of types other than error are
+// reported as an exception of "panic" type with value formatted in the manner
+// of fmt.Print.
+func (c *Client) CapturePanic(v interface{}, stack []byte) {
+	if c == nil || v == nil || c.isDisabled() {
+		return
+	}
+	var err *panicError
+	switch frames := parseStack(stack); {
+	case len(frames) > 0:
+		err = &panicError{val: v, frames: frames}
+	default:
+		err = newPanicError(v, 1)
+	}
+	evt := newEvent(err.Error(), "", []interface{}{err}, c)
+	evt.Level = LevelFatal
+	c.push(evt.message(c))
+	if c.forward(LevelFatal) {
+		c.log.Print(err)
+	}
+}
+
+// panicError is an error created from a recovered panic value, it holds stack
+// trace of the panicking goroutine
+type panicError struct {
+	val    interface{}
+	stack  []uintptr
+	frames []frame // if set, used instead of stack
+}
+
+// newPanicError returns panicError for recovered value v with stack trace of
+// the current goroutine. If called from a deferred function during panicking,
+// stack trace starts at the function that panicked. skip is the number of
+// stack frames to skip, with 0 identifying the caller of newPanicError.
+func newPanicError(v interface{}, skip int) *panicError {
+	pcs := make([]uintptr, 32)
+	pcs = pcs[:runtime.Callers(skip+2, pcs)]
+	for i, pc := range pcs {
+		if fn := runtime.FuncForPC(pc - 1); fn != nil && fn.Name() == "runtime.gopanic" {
+			pcs = pcs[i+1:]
+			break
+		}
+	}
+	return &panicError{val: v, stack: pcs}
+}
+
+func (e *panicError) Error() string { return fmt.Sprint("panic: ", e.val) }
+
+func (e *panicError) StackTrace() errors.StackTrace {
+	st := make(errors.StackTrace, len(e.stack))
+	for i, pc := range e.stack {
+		st[i] = errors.Frame(pc)
+	}
+	return st
+}
+
+// parseStack parses stack trace of the first goroutine from stack in the
+// format of runtime/debug.Stack. If stack trace includes panic call, frames
+// up to and including it are skipped.
+func parseStack(stack []byte) []frame {
+	gs := parseGoroutines(stack)
+	if len(gs) == 0 || len(gs[0].frames) == 0 {
+		return nil
+	}
+	return trimPanicFrames(gs[0].frames)
+}
+
+// trimPanicFrames removes frames up to and including panic call and shortens
+// function names to the format used by github.com/pkg/errors
+func trimPanicFrames(frames []frame) []frame {
+	for i := range frames {
+		if frames[i].Func == "panic" {
+			frames = frames[i+1:]
+			break
+		}
+	}
+	for i := range frames {
+		frames[i].Func = shortFuncName(frames[i].Func)
+	}
+	return frames
+}
+
+// shortFuncName returns function name without package path
+func shortFuncName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// funcModule returns package path of fully qualified function name
+func funcModule(name string) string {
+	i := strings.LastIndex(name, "/")
+	if j := strings.Index(name[i+1:], "."); j >= 0 {
+		return name[:i+1+j]
+	}
+	return ""
+}
+
+// packagePath is import path of this package
+const packagePath = "github.com/artyom/raven"
+
+// callerCulprit returns "dir/file.go:line" location of the innermost caller
+// outside of this package and its subpackages, used as event culprit when errors carry no stack
+// traces. Frames of standard log package are skipped as well, as they appear
+// between user code and Client when it's used as log.Logger output. Returns
+// empty string if no suitable caller is found.
+func callerCulprit() string {
+	var pcs [32]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs[:])])
+	for {
+		f, more := frames.Next()
+		switch mod := funcModule(f.Function); {
+		case mod == packagePath, strings.HasPrefix(mod, packagePath+"/"):
+		case mod == "log", mod == "runtime":
+		default:
+			if f.File == "" {
+				return ""
+			}
+			return path.Join(path.Base(path.Dir(f.File)), path.Base(f.File)) +
+				":" + strconv.Itoa(f.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
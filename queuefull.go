@@ -0,0 +1,76 @@
+package raven
+
+import "errors"
+
+// QueueFullPolicy defines what Client does with a new message when its queue
+// is full.
+type QueueFullPolicy int
+
+const (
+	// DropNewest discards the new message. This is the default policy: it
+	// never blocks and keeps the earliest messages, which often describe the
+	// root cause of a burst of errors.
+	DropNewest QueueFullPolicy = iota
+	// DropOldest discards the oldest queued message to make room for the new
+	// one. It never blocks and favors recent messages, at the cost of losing
+	// the beginning of a burst of errors.
+	DropOldest
+	// Block makes logging methods wait until queue has room for the new
+	// message, or until Client is closed. No messages are lost, but logging
+	// calls may block for a long time if Sentry API is slow or unreachable.
+	Block
+)
+
+// WithQueueFullBehavior configures what Client does when its queue is full,
+// see QueueFullPolicy for available policies and their trade-offs. Messages
+// dropped are reported as queue overflow. Policy only applies to the queue
+// length limit, messages exceeding limit set with WithMaxQueueBytes are
+// always dropped. Default policy is DropNewest.
+func WithQueueFullBehavior(policy QueueFullPolicy) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if policy != DropNewest && policy != DropOldest && policy != Block {
+			return nil, errors.New("unknown queue full policy")
+		}
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.queueFull = policy
+		return c, nil
+	}
+}
+
+// pushFull puts message into full queue according to queue full policy, it
+// reports whether message was queued
+func (c *Client) pushFull(msg *message) bool {
+	switch c.queueFull {
+	case Block:
+		select {
+		case c.messages <- msg:
+			return true
+		case <-c.done:
+			return false
+		}
+	case DropOldest:
+		for {
+			select {
+			case old := <-c.messages:
+				c.queued.Add(-int64(len(old.payload)))
+				c.pending.Add(-1)
+				if old.apply != nil {
+					old.apply(c)
+					old.done(nil)
+				} else {
+					c.overflow(old)
+				}
+			default:
+			}
+			select {
+			case c.messages <- msg:
+				return true
+			default:
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+module github.com/artyom/raven/ravenprom
+
+// go 1.25.0 is the minimum required by github.com/prometheus/client_golang
+// v1.24.1 and its dependencies; raven itself only requires go 1.20.
+go 1.25.0
+
+require (
+	github.com/artyom/raven v0.0.0-20261016180534-44034c725fcc
+	github.com/prometheus/client_golang v1.24.1
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/pkg/errors v0.8.0 // indirect
+	github.com/prometheus/client_model v0.6.2 // indirect
+	github.com/prometheus/common v0.70.1 // indirect
+	github.com/prometheus/procfs v0.21.1 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+)
@@ -0,0 +1,80 @@
+// Package ravenprom exposes raven.Client statistics as Prometheus metrics.
+//
+// It is a separate module, so that programs not using Prometheus do not
+// depend on its client library through raven:
+//
+//	prometheus.MustRegister(ravenprom.NewCollector(client))
+//
+// Module requires a published version of raven. To work on both modules from
+// a single checkout, create a workspace in repository root (go.work is ignored
+// by git):
+//
+//	go work init . ./ravenprom
+package ravenprom
+
+import (
+	"github.com/artyom/raven"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector implements prometheus.Collector interface reporting statistics
+// of raven.Client as the following metrics:
+//
+//	raven_events_sent_total             counter
+//	raven_events_dropped_total{reason}  counter
+//	raven_send_errors_total             counter
+//	raven_queue_depth                   gauge
+//
+// Reason label of dropped events is one of "overflow", "sampled", "ignored"
+// and "expired". Statistics are read with raven.Client.Stats on every
+// collection.
+type Collector struct {
+	client     *raven.Client
+	sent       *prometheus.Desc
+	dropped    *prometheus.Desc
+	sendErrors *prometheus.Desc
+	queueDepth *prometheus.Desc
+}
+
+// NewCollector returns Collector reporting statistics of c, which are shared
+// by c and all subloggers derived from it.
+func NewCollector(c *raven.Client) *Collector {
+	return &Collector{
+		client: c,
+		sent: prometheus.NewDesc("raven_events_sent_total",
+			"Number of events delivered to Sentry.", nil, nil),
+		dropped: prometheus.NewDesc("raven_events_dropped_total",
+			"Number of events dropped before delivery, by reason.", []string{"reason"}, nil),
+		sendErrors: prometheus.NewDesc("raven_send_errors_total",
+			"Number of failed attempts to deliver events to Sentry.", nil, nil),
+		queueDepth: prometheus.NewDesc("raven_queue_depth",
+			"Number of events waiting in queue to be sent.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector interface.
+func (col *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- col.sent
+	ch <- col.dropped
+	ch <- col.sendErrors
+	ch <- col.queueDepth
+}
+
+// Collect implements prometheus.Collector interface.
+func (col *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := col.client.Stats()
+	ch <- prometheus.MustNewConstMetric(col.sent, prometheus.CounterValue, float64(s.Sent))
+	for _, d := range []struct {
+		reason string
+		n      int64
+	}{
+		{"overflow", s.Overflowed},
+		{"sampled", s.Sampled},
+		{"ignored", s.Ignored},
+		{"expired", s.Expired},
+	} {
+		ch <- prometheus.MustNewConstMetric(col.dropped, prometheus.CounterValue, float64(d.n), d.reason)
+	}
+	ch <- prometheus.MustNewConstMetric(col.sendErrors, prometheus.CounterValue, float64(s.SendErrors))
+	ch <- prometheus.MustNewConstMetric(col.queueDepth, prometheus.GaugeValue, float64(s.Queued))
+}
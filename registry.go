@@ -0,0 +1,59 @@
+package raven
+
+import "sync"
+
+// liveClients tracks Clients created with New whose background goroutines
+// are still running
+var liveClients struct {
+	mu sync.Mutex
+	m  map[*Client]struct{}
+}
+
+func registerClient(c *Client) {
+	liveClients.mu.Lock()
+	defer liveClients.mu.Unlock()
+	if liveClients.m == nil {
+		liveClients.m = make(map[*Client]struct{})
+	}
+	liveClients.m[c] = struct{}{}
+}
+
+func unregisterClient(c *Client) {
+	liveClients.mu.Lock()
+	defer liveClients.mu.Unlock()
+	delete(liveClients.m, c)
+}
+
+// CloseAll closes all Clients created with New which were not closed yet and
+// waits until their background goroutines exit. Clients are closed
+// concurrently, each of them is given time configured with
+// WithShutdownTimeout to flush its queue.
+//
+// Every Client created with New runs background goroutines until it is
+// closed, so creating Clients repeatedly without closing them leaks
+// goroutines. CloseAll is meant as a safety net for test suites creating
+// Clients in many places:
+//
+//	func TestMain(m *testing.M) {
+//		code := m.Run()
+//		raven.CloseAll()
+//		os.Exit(code)
+//	}
+func CloseAll() {
+	liveClients.mu.Lock()
+	clients := make([]*Client, 0, len(liveClients.m))
+	for c := range liveClients.m {
+		clients = append(clients, c)
+	}
+	liveClients.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			c.Close()
+			c.Wait()
+		}(c)
+	}
+	wg.Wait()
+}
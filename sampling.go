@@ -0,0 +1,156 @@
+package raven
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SamplingStrategy defines how Client selects messages to send when sample
+// rate is configured with WithSampleRate.
+type SamplingStrategy int
+
+const (
+	// SampleRandom sends random fraction of messages
+	SampleRandom SamplingStrategy = iota
+	// SampleByFingerprint always sends the first message of each distinct
+	// fingerprint seen within sampling window, other messages are sampled
+	// randomly. Fingerprint is derived from exception types and stack
+	// traces, or from message format for messages without errors. Up to
+	// 10000 fingerprints are remembered, when there are more of them within
+	// sampling window, the oldest ones are forgotten first.
+	SampleByFingerprint
+)
+
+const (
+	sampleWindow  = time.Hour // period to remember seen fingerprints for
+	maxSampleSeen = 10000     // max. number of fingerprints remembered
+)
+
+// WithSamplingStrategy configures Client to use given strategy when sampling
+// messages. Strategy only takes effect if sample rate is set with
+// WithSampleRate. Default strategy is SampleRandom.
+func WithSamplingStrategy(s SamplingStrategy) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if s != SampleRandom && s != SampleByFingerprint {
+			return nil, errors.New("unknown sampling strategy")
+		}
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.sampling = s
+		return c, nil
+	}
+}
+
+// WithLevelSampleRates configures Client to only send given fraction of
+// messages of each level, i.e. to send all errors but only a tenth of
+// informational messages:
+//
+//	raven.WithLevelSampleRates(map[raven.Severity]float64{
+//		raven.LevelDebug: 0,
+//		raven.LevelInfo:  0.1,
+//	})
+//
+// Rates should be in [0, 1] range. Rate set for a level takes precedence over
+// rate set with WithSampleRate, which still applies to levels missing from
+// rates; if WithSampleRate is not used, messages of such levels are always
+// sent. Sampling strategy set with WithSamplingStrategy applies to per-level
+// rates as well.
+func WithLevelSampleRates(rates map[Severity]float64) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		for level, rate := range rates {
+			if !level.valid() {
+				return nil, fmt.Errorf("invalid sampling level %v", level)
+			}
+			if !(rate >= 0 && rate <= 1) {
+				return nil, fmt.Errorf("sample rate for level %v should be in [0, 1] range", level)
+			}
+		}
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.levelRates = make(map[Severity]float64, len(rates))
+		for level, rate := range rates {
+			c.levelRates[level] = rate
+		}
+		return c, nil
+	}
+}
+
+// sampleRateFor returns fraction of messages of given level to send.
+func (c *Client) sampleRateFor(level Severity) float64 {
+	if rate, ok := c.levelRates[level]; ok {
+		return rate
+	}
+	if c.sampleRate > 0 {
+		return c.sampleRate
+	}
+	return 1
+}
+
+// firstSeen reports whether message fingerprint was not seen within
+// current sampling window and records it.
+func (c *Client) firstSeen(msg *message) bool {
+	if c.sampling != SampleByFingerprint || msg.fingerprint == "" {
+		return false
+	}
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil || now.Sub(c.seenSince) >= sampleWindow {
+		c.seen = make(map[string]struct{})
+		c.seenOrder, c.seenNext = nil, 0
+		c.seenSince = now
+	}
+	if _, ok := c.seen[msg.fingerprint]; ok {
+		return false
+	}
+	if len(c.seenOrder) < maxSampleSeen {
+		c.seenOrder = append(c.seenOrder, msg.fingerprint)
+	} else { // forget the oldest fingerprint
+		delete(c.seen, c.seenOrder[c.seenNext])
+		c.seenOrder[c.seenNext] = msg.fingerprint
+		c.seenNext = (c.seenNext + 1) % maxSampleSeen
+	}
+	c.seen[msg.fingerprint] = struct{}{}
+	return true
+}
+
+// fingerprint returns hash of event fingerprint if it is set, otherwise hash
+// of event properties Sentry uses to group events by default: exception
+// types and stack trace functions, or message format if event has no
+// exceptions.
+func (evt *event) fingerprint() string {
+	h := fnv.New64a()
+	if len(evt.Fingerprint) > 0 {
+		for _, s := range evt.Fingerprint {
+			fmt.Fprintln(h, s)
+		}
+		return fmt.Sprintf("%016x", h.Sum64())
+	}
+	if len(evt.Exceptions) == 0 {
+		format := evt.Text
+		if evt.Details != nil {
+			format = evt.Details.Format
+		}
+		io.WriteString(h, format)
+	}
+	for _, e := range evt.Exceptions {
+		cause := errors.Cause(e.err)
+		fmt.Fprintf(h, "%T\n", cause)
+		frames := errorFrames(e.err)
+		if len(frames) == 0 {
+			fmt.Fprintln(h, cause.Error())
+		}
+		for _, f := range frames {
+			fmt.Fprintln(h, f.Func)
+		}
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
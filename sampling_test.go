@@ -0,0 +1,74 @@
+package raven
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/artyom/raven/ravenutil"
+	"github.com/pkg/errors"
+)
+
+func TestClient_sampleByFingerprint(t *testing.T) {
+	c := &Client{
+		shared:     new(shared),
+		messages:   make(chan *message, 100),
+		sampleRate: 0.0001,
+		sampling:   SampleByFingerprint,
+		clock:      new(ravenutil.Clock),
+	}
+	for i := 0; i < 10; i++ {
+		c.Printf("repeated message %d", i)
+		c.Print(errors.New("repeated error"))
+	}
+	if n := len(c.messages); n != 2 {
+		t.Fatalf("wrong number of queued messages: got %d, want 2", n)
+	}
+	c.clock.(*ravenutil.Clock).Sleep(sampleWindow)
+	c.Print(errors.New("repeated error"))
+	if n := len(c.messages); n != 3 {
+		t.Fatalf("fingerprint not reset after sampling window: got %d messages, want 3", n)
+	}
+}
+
+func TestWithLevelSampleRates(t *testing.T) {
+	c, err := WithLevelSampleRates(map[Severity]float64{LevelInfo: 0, LevelError: 1})(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		c.Print("informational message")
+		c.Print(errors.New("error message"))
+		c.CaptureMessageLevel(LevelWarning, "warning message")
+	}
+	// info is never sent, levels without rate are always sent
+	if n := len(c.messages); n != 20 {
+		t.Fatalf("wrong number of queued messages: got %d, want 20", n)
+	}
+	for _, rates := range []map[Severity]float64{
+		{LevelInfo: 1.5},
+		{LevelInfo: -1},
+		{Severity(0): 0.5},
+	} {
+		if _, err := WithLevelSampleRates(rates)(nil); err == nil {
+			t.Errorf("invalid rates %v accepted", rates)
+		}
+	}
+}
+
+func TestClient_firstSeenLimit(t *testing.T) {
+	c := newTestClient(t, WithSamplingStrategy(SampleByFingerprint), WithClock(new(ravenutil.Clock)))
+	for i := 0; i <= maxSampleSeen; i++ {
+		if !c.firstSeen(&message{fingerprint: strconv.Itoa(i)}) {
+			t.Fatalf("fingerprint %d reported as seen", i)
+		}
+	}
+	if c.firstSeen(&message{fingerprint: strconv.Itoa(maxSampleSeen)}) {
+		t.Fatal("the latest fingerprint was forgotten")
+	}
+	if !c.firstSeen(&message{fingerprint: "0"}) {
+		t.Fatal("the oldest fingerprint was not forgotten")
+	}
+	if len(c.seen) != maxSampleSeen {
+		t.Fatalf("wrong number of remembered fingerprints: %d", len(c.seen))
+	}
+}
@@ -3,7 +3,10 @@ package raven
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -15,23 +18,69 @@ type event struct {
 	ID        string   `json:"event_id"`
 	Text      string   `json:"message"`
 	Timestamp string   `json:"timestamp"`
-	Level     severity `json:"level,omitempty"`
+	Level     Severity `json:"level,omitempty"`
 	Culprit   string   `json:"culprit,omitempty"`
-	Platform  string   `json:"platform"`
-	Hostname  string   `json:"server_name,omitempty"`
+
+	// https://develop.sentry.dev/sdk/event-payloads/#optional-attributes
+	Transaction     string           `json:"transaction,omitempty"`
+	TransactionInfo *transactionInfo `json:"transaction_info,omitempty"`
+
+	Platform string `json:"platform"`
+	Hostname string `json:"server_name,omitempty"`
+
+	Environment string `json:"environment,omitempty"`
+	Release     string `json:"release,omitempty"`
 
 	// https://docs.sentry.io/clientdev/attributes/
 	Tags  map[string]string `json:"tags,omitempty"`
 	Extra json.RawMessage   `json:"extra,omitempty"`
 
+	// https://develop.sentry.dev/sdk/event-payloads/contexts/
+	Contexts map[string]json.RawMessage `json:"contexts,omitempty"`
+
+	// https://develop.sentry.dev/sdk/event-payloads/transaction/#measurements
+	Measurements map[string]measurement `json:"measurements,omitempty"`
+
+	// https://docs.sentry.io/data-management/event-grouping/sdk-fingerprinting/
+	Fingerprint []string `json:"fingerprint,omitempty"`
+
 	// https://docs.sentry.io/clientdev/interfaces/exception/
 	Exceptions exceptions `json:"exception,omitempty"`
 
+	// https://develop.sentry.dev/sdk/event-payloads/threads/
+	Threads *threads `json:"threads,omitempty"`
+
 	// https://docs.sentry.io/clientdev/interfaces/message/
 	Details *details `json:"logentry,omitempty"`
 
+	// https://develop.sentry.dev/sdk/event-payloads/breadcrumbs/
+	Breadcrumbs *breadcrumbs `json:"breadcrumbs,omitempty"`
+
 	// https://docs.sentry.io/clientdev/interfaces/http/
 	Request *reqInfo `json:"request,omitempty"`
+
+	// https://develop.sentry.dev/sdk/event-payloads/#optional-attributes
+	Modules   map[string]string `json:"modules,omitempty"`
+	DebugMeta *debugMeta        `json:"debug_meta,omitempty"`
+
+	ts          time.Time    // same as Timestamp, used for message creation
+	attachments []attachment // if set, event is sent as an envelope
+	ignored     bool         // if set, event should not be sent
+
+	// encodes extra data, see WithExtraMarshaler
+	marshal func(interface{}) (json.RawMessage, error)
+	// decoded fields of Extra, if known
+	extraFields map[string]json.RawMessage
+}
+
+type measurement struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+}
+
+// https://develop.sentry.dev/sdk/event-payloads/transaction/#transaction-annotations
+type transactionInfo struct {
+	Source string `json:"source"`
 }
 
 type reqInfo struct {
@@ -50,54 +99,102 @@ type details struct {
 type exceptions []ravenException
 
 type ravenException struct {
-	err error
+	err  error
+	vars map[string]string // local variables of the top frame
 }
 
 func (e *ravenException) MarshalJSON() ([]byte, error) {
-	type frame struct {
-		File string `json:"filename,omitempty"`
-		Func string `json:"function,omitempty"`
-		Line int    `json:"lineno"`
-	}
 	type stackTrace struct {
 		Frames []frame `json:"frames"`
 	}
+	// https://develop.sentry.dev/sdk/event-payloads/exception/#exception-mechanism
+	type mechanism struct {
+		Type    string `json:"type"`
+		Handled bool   `json:"handled"`
+	}
 	interm := struct {
-		Type  string      `json:"type"`
-		Text  string      `json:"value"`
-		Trace *stackTrace `json:"stacktrace,omitempty"`
+		Type      string      `json:"type"`
+		Text      string      `json:"value"`
+		Trace     *stackTrace `json:"stacktrace,omitempty"`
+		Mechanism mechanism   `json:"mechanism"`
 	}{
-		Type: "error",
-		Text: e.err.Error(),
+		Type:      "error",
+		Text:      e.err.Error(),
+		Mechanism: mechanism{Type: "generic", Handled: true},
 	}
-	if e, ok := errors.Cause(e.err).(stackTracer); ok {
-		interm.Trace = new(stackTrace)
-		for i, st := range e.StackTrace() {
-			if i > maxFrames-1 {
-				break
-			}
-			fr := frame{
-				File: fmt.Sprintf("%s", st),
-				Func: fmt.Sprintf("%n", st),
-			}
-			if n, err := strconv.Atoi(fmt.Sprintf("%d", st)); err == nil {
-				fr.Line = n
-			}
-			interm.Trace.Frames = append(interm.Trace.Frames, fr)
+	if s, ok := sanitize(interm.Text); ok {
+		interm.Text = s
+	}
+	if _, ok := errors.Cause(e.err).(*panicError); ok {
+		interm.Type = "panic"
+		interm.Mechanism = mechanism{Type: "panic", Handled: false}
+	}
+	if frames := errorFrames(e.err); len(frames) > 0 {
+		if len(frames) > maxFrames {
+			frames = frames[:maxFrames]
 		}
+		frames[0].Vars = e.vars
+		interm.Trace = &stackTrace{Frames: frames}
 	}
 	return json.Marshal(interm)
 }
 
-// severity is a Sentry log entry level
-type severity int
+// frame is a single stack trace frame
+type frame struct {
+	File    string `json:"filename,omitempty"`
+	AbsPath string `json:"abs_path,omitempty"`
+	Func    string `json:"function,omitempty"`
+	Module  string `json:"module,omitempty"`
+	Line    int    `json:"lineno"`
 
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+// errorFrames returns stack trace of error cause, if it has one
+func errorFrames(err error) []frame {
+	cause := errors.Cause(err)
+	if e, ok := cause.(*panicError); ok && e.frames != nil {
+		return e.frames
+	}
+	e, ok := cause.(stackTracer)
+	if !ok {
+		return nil
+	}
+	st := e.StackTrace()
+	frames := make([]frame, 0, len(st))
+	for _, f := range st {
+		fr := frame{
+			File: fmt.Sprintf("%s", f),
+			Func: fmt.Sprintf("%n", f),
+		}
+		if n, err := strconv.Atoi(fmt.Sprintf("%d", f)); err == nil {
+			fr.Line = n
+		}
+		// %+s formats frame as "pkg/path.funcName\n\t/abs/path/file.go"
+		if name, file, ok := strings.Cut(fmt.Sprintf("%+s", f), "\n\t"); ok {
+			fr.AbsPath = file
+			fr.Module = funcModule(name)
+		}
+		frames = append(frames, fr)
+	}
+	return frames
+}
+
+// platformName matches valid platform identifiers. Sentry accepts any
+// lowercase identifier and applies specific processing to the ones it knows,
+// i.e. "python" or "javascript".
+var platformName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// Severity is a Sentry event level
+type Severity int
+
+// Event levels supported by Sentry
 const (
-	levelFatal severity = 1 + iota
-	levelError
-	levelWarning
-	levelInfo
-	levelDebug
+	LevelFatal Severity = 1 + iota
+	LevelError
+	LevelWarning
+	LevelInfo
+	LevelDebug
 )
 
 var levels = [...]string{
@@ -108,6 +205,13 @@ var levels = [...]string{
 	"debug",
 }
 
-func (s severity) String() string { return levels[s-1] }
+func (s Severity) String() string {
+	if !s.valid() {
+		return "Severity(" + strconv.Itoa(int(s)) + ")"
+	}
+	return levels[s-1]
+}
+
+func (s Severity) valid() bool { return s >= LevelFatal && s <= LevelDebug }
 
-func (s severity) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+func (s Severity) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
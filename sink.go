@@ -0,0 +1,40 @@
+package raven
+
+import (
+	"errors"
+	"io"
+)
+
+// WithLocalSink configures Client to write events to w instead of sending
+// them to Sentry API when DSN is not configured, so that New does not require
+// WithDSN. Each event is written in the exact format it would be sent in
+// (json-encoded event or envelope), followed by a newline. This is meant for
+// local development without Sentry instance, i.e. WithLocalSink(os.Stderr).
+// If DSN is configured, w is not used.
+func WithLocalSink(w io.Writer) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if w == nil {
+			return nil, errors.New("nil local sink")
+		}
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.localSink = w
+		return c, nil
+	}
+}
+
+// writeLocal writes message payload to local sink
+func (c *Client) writeLocal(msg *message) error {
+	m := *msg
+	if m.gzipped {
+		if err := m.decompress(); err != nil {
+			return err
+		}
+	}
+	c.sinkMu.Lock()
+	defer c.sinkMu.Unlock()
+	_, err := c.localSink.Write(append(m.payload[:len(m.payload):len(m.payload)], '\n'))
+	return err
+}
@@ -0,0 +1,209 @@
+package raven
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSpoolSize is the max. total size of files in spool directory
+const maxSpoolSize = 16 << 20
+
+// WithSpoolDir configures Client to save messages it failed to deliver to
+// files in given directory, so that they can be sent later. Messages which
+// are still queued when Client is closed are saved as well. On start, New
+// queues messages found in this directory, removing their files once they
+// are delivered. Messages rejected by Sentry as invalid are not saved. Total
+// size of saved messages is limited to 16MiB, messages exceeding this limit
+// are dropped.
+//
+// Directory must exist. Only one Client should use given directory at a time.
+func WithSpoolDir(dir string) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if fi, err := os.Stat(dir); err != nil {
+			return nil, err
+		} else if !fi.IsDir() {
+			return nil, errors.New("spool path is not a directory")
+		}
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.spoolDir = dir
+		return c, nil
+	}
+}
+
+const (
+	spoolPrefix      = "raven-"
+	spoolExtEvent    = ".event"
+	spoolExtEnvelope = ".envelope"
+	spoolExtGzip     = ".gz"
+)
+
+// loadSpool queues messages saved in spool directory. If queue cannot hold
+// all of them, the rest is left for the next start. It also initializes total
+// size of spooled messages which spool keeps track of afterwards.
+func (c *Client) loadSpool() {
+	names, err := filepath.Glob(filepath.Join(c.spoolDir, spoolPrefix+"*"))
+	if err != nil {
+		return
+	}
+	var size int64
+	for _, name := range names {
+		if fi, err := os.Stat(name); err == nil {
+			size += fi.Size()
+		}
+	}
+	c.spoolSize.Store(size)
+	sort.Strings(names)
+	for _, name := range names {
+		m, err := c.readSpoolFile(name)
+		if err != nil {
+			if c.log != nil {
+				c.log.Printf("raven failed to load spooled message: %v", err)
+			}
+			continue
+		}
+		c.pending.Add(1)
+		select {
+		case c.messages <- m:
+			c.queued.Add(int64(len(m.payload)))
+		default:
+			c.pending.Add(-1)
+			return
+		}
+	}
+}
+
+// readSpoolFile returns message saved to given file by spool method
+func (c *Client) readSpoolFile(name string) (*message, error) {
+	base := filepath.Base(name)
+	gzipped := strings.HasSuffix(base, spoolExtGzip)
+	ext := filepath.Ext(strings.TrimSuffix(base, spoolExtGzip))
+	if ext != spoolExtEvent && ext != spoolExtEnvelope {
+		return nil, fmt.Errorf("unexpected spool file %q", name)
+	}
+	fields := strings.SplitN(strings.TrimPrefix(base, spoolPrefix), "-", 2)
+	nsec, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected spool file %q", name)
+	}
+	payload, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &message{
+		text:      base,
+		ts:        time.Unix(0, nsec).UTC(),
+		created:   c.now(),
+		envelope:  ext == spoolExtEnvelope,
+		gzipped:   gzipped,
+		payload:   payload,
+		spoolFile: name,
+	}, nil
+}
+
+// spool saves message to the spool directory. Message which was loaded from
+// spool directory is not saved again, as its file still exists.
+func (c *Client) spool(m *message) {
+	if m.spoolFile != "" || len(m.payload) == 0 {
+		return
+	}
+	size := int64(len(m.payload))
+	if c.spoolSize.Add(size) > maxSpoolSize {
+		c.spoolSize.Add(-size)
+		if c.log != nil {
+			c.log.Printf("raven spool directory is full, dropping message %q", m.text)
+		}
+		return
+	}
+	ext := spoolExtEvent
+	if m.envelope {
+		ext = spoolExtEnvelope
+	}
+	if m.gzipped {
+		ext += spoolExtGzip
+	}
+	name := filepath.Join(c.spoolDir,
+		fmt.Sprintf("%s%019d-%s%s", spoolPrefix, m.ts.UnixNano(), randomID(), ext))
+	if err := writeFileAtomic(name, m.payload); err != nil {
+		c.spoolSize.Add(-size)
+		if c.log != nil {
+			c.log.Printf("raven failed to spool message %q: %v", m.text, err)
+		}
+	}
+}
+
+// removeSpoolFile removes file of message loaded from spool directory
+func (c *Client) removeSpoolFile(name string) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return
+	}
+	if os.Remove(name) == nil {
+		c.spoolSize.Add(-fi.Size())
+	}
+}
+
+// spoolQueue saves all queued messages to spool directory
+func (c *Client) spoolQueue() {
+	for {
+		select {
+		case m := <-c.messages:
+			c.queued.Add(-int64(len(m.payload)))
+			if m.apply != nil {
+				m.apply(c)
+				m.done(nil)
+				continue
+			}
+			c.spool(m)
+		default:
+			return
+		}
+	}
+}
+
+// spoolResult updates spool directory according to message delivery result:
+// spool file of successfully delivered message is removed, message that
+// failed to be delivered is saved.
+func (c *Client) spoolResult(m *message, err error) {
+	if c.spoolDir == "" {
+		return
+	}
+	switch {
+	case err == nil && m.spoolFile != "":
+		c.removeSpoolFile(m.spoolFile)
+	case err != nil:
+		if _, ok := err.(permanentError); ok {
+			if m.spoolFile != "" {
+				c.removeSpoolFile(m.spoolFile)
+			}
+			return
+		}
+		c.spool(m)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to name, so
+// that partially written files are never loaded
+func writeFileAtomic(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-raven-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
@@ -0,0 +1,64 @@
+package raven
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/artyom/raven/ravenutil"
+)
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	c := &Client{shared: new(shared), spoolDir: dir, messages: make(chan *message, 10)}
+	msg := newMessage("spooled message", "", nil, c)
+	c.spool(msg)
+	c.loadSpool()
+	if l := len(c.messages); l != 1 {
+		t.Fatalf("wrong number of loaded messages: got %d, want 1", l)
+	}
+	m := <-c.messages
+	if !bytes.Equal(m.payload, msg.payload) {
+		t.Fatalf("wrong payload of loaded message: got %s, want %s", m.payload, msg.payload)
+	}
+	if !m.ts.Equal(msg.ts) {
+		t.Fatalf("wrong timestamp of loaded message: got %v, want %v", m.ts, msg.ts)
+	}
+	c.spoolResult(m, errThrottled) // already spooled, should not be saved again
+	if names, _ := filepath.Glob(filepath.Join(dir, "*")); len(names) != 1 {
+		t.Fatalf("wrong spool directory content: %v", names)
+	}
+	c.spoolResult(m, nil)
+	if names, _ := filepath.Glob(filepath.Join(dir, "*")); len(names) != 0 {
+		t.Fatalf("spool file not removed after delivery: %v", names)
+	}
+}
+
+func TestSpool_size(t *testing.T) {
+	dir := t.TempDir()
+	clock := new(ravenutil.Clock)
+	c := &Client{shared: new(shared), spoolDir: dir, messages: make(chan *message, 10), clock: clock}
+	msg := newMessage("spooled message", "", nil, c)
+	c.spool(msg)
+	size := int64(len(msg.payload))
+	if n := c.spoolSize.Load(); n != size {
+		t.Fatalf("wrong spool size: got %d, want %d", n, size)
+	}
+	c.spoolSize.Store(maxSpoolSize)
+	c.spool(newMessage("dropped message", "", nil, c))
+	if names, _ := filepath.Glob(filepath.Join(dir, "*")); len(names) != 1 {
+		t.Fatalf("message spooled over size limit: %v", names)
+	}
+	c.loadSpool()
+	if n := c.spoolSize.Load(); n != size {
+		t.Fatalf("wrong spool size after load: got %d, want %d", n, size)
+	}
+	m := <-c.messages
+	if !m.created.Equal(clock.Now()) {
+		t.Fatalf("loaded message creation time is not taken from Client clock: %v", m.created)
+	}
+	c.spoolResult(m, nil)
+	if n := c.spoolSize.Load(); n != 0 {
+		t.Fatalf("wrong spool size after delivery: got %d, want 0", n)
+	}
+}
@@ -0,0 +1,41 @@
+package raven
+
+// Stats holds Client statistics, see Client.Stats method.
+type Stats struct {
+	Payloads     int64 // number of created message payloads
+	PayloadBytes int64 // total size of created message payloads
+	MinPayload   int   // size of the smallest payload
+	MaxPayload   int   // size of the largest payload
+
+	Requeued int64 // number of times failed messages were requeued
+	Expired  int64 // messages dropped after exceeding requeue limits
+
+	SlowSends int64 // sends slower than WithSlowSendThreshold limit
+
+	Sent       int64 // messages successfully delivered
+	SendErrors int64 // failed delivery attempts, including requeued ones
+	Overflowed int64 // messages dropped because queue was full
+	Sampled    int64 // messages discarded by sampling
+	Ignored    int64 // messages discarded as ignored or below min. level
+
+	Queued int // number of messages in queue at the time of Stats call
+}
+
+// AvgPayload returns average payload size
+func (s Stats) AvgPayload() int {
+	if s.Payloads == 0 {
+		return 0
+	}
+	return int(s.PayloadBytes / s.Payloads)
+}
+
+func (s *Stats) addPayload(size int) {
+	if s.Payloads == 0 || size < s.MinPayload {
+		s.MinPayload = size
+	}
+	if size > s.MaxPayload {
+		s.MaxPayload = size
+	}
+	s.Payloads++
+	s.PayloadBytes += int64(size)
+}
@@ -0,0 +1,32 @@
+package raven
+
+import "testing"
+
+func TestStats_addPayload(t *testing.T) {
+	var s Stats
+	for _, size := range []int{200, 100, 600} {
+		s.addPayload(size)
+	}
+	want := Stats{Payloads: 3, PayloadBytes: 900, MinPayload: 100, MaxPayload: 600}
+	if s != want {
+		t.Fatalf("wrong stats: got %+v, want %+v", s, want)
+	}
+	if got := s.AvgPayload(); got != 300 {
+		t.Fatalf("wrong average payload size: got %d, want 300", got)
+	}
+}
+
+func TestClient_StatsDropped(t *testing.T) {
+	c := &Client{
+		shared:   new(shared),
+		messages: make(chan *message, 1),
+		minLevel: LevelWarning,
+	}
+	c.Print("informational message")
+	c.CaptureMessageLevel(LevelError, "first")
+	c.CaptureMessageLevel(LevelError, "second")
+	s := c.Stats()
+	if s.Ignored != 1 || s.Overflowed != 1 || s.Queued != 1 {
+		t.Fatalf("wrong stats: %+v", s)
+	}
+}
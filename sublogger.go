@@ -1,18 +1,35 @@
 package raven
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // AttachRequestInfo returns sublogger that sends given http.Request information
 // with every message it logs. If Logger is not a *Client (i.e. it is
-// *log.Logger), this function returns logger itself.
+// *log.Logger), this function returns logger itself. If logger already has
+// information of the same request attached, it is returned as is; otherwise
+// information of r replaces previously attached one. Request identifiers from
+// headers are also attached as tags, see WithRequestIDTags; identifier tags
+// of previously attached request are removed.
 func AttachRequestInfo(l Logger, r *http.Request) Logger {
 	c, ok := l.(*Client)
-	if !ok {
+	if !ok || c == nil {
+		return l
+	}
+	key := newRequestKey(r)
+	if c.httpReq != nil && c.httpReqKey == key {
 		return l
 	}
 	u := new(url.URL)
@@ -33,6 +50,101 @@ func AttachRequestInfo(l Logger, r *http.Request) Logger {
 	}
 	c2 := c.clone()
 	c2.httpReq = req
+	c2.httpReqKey = key
+	mapping := c.reqIDTags
+	if mapping == nil {
+		mapping = defaultRequestIDTags
+	}
+	var tags map[string]string
+	var stale bool // whether identifiers of previous request must be removed
+	for tag, header := range mapping {
+		v := r.Header.Get(header)
+		if v == "" {
+			if _, ok := c.tags[tag]; ok && c.httpReq != nil {
+				stale = true
+			}
+			continue
+		}
+		if tags == nil {
+			tags = make(map[string]string, len(mapping))
+		}
+		tags[tag] = v
+	}
+	if tags != nil || stale {
+		c2.tags = mergeTags(c.tags, tags)
+	}
+	if stale {
+		for tag := range mapping {
+			if _, ok := tags[tag]; !ok {
+				delete(c2.tags, tag)
+			}
+		}
+	}
+	return c2
+}
+
+// requestKey identifies request without keeping it reachable: it holds request
+// address along with its method and URI, so that another request allocated at
+// the same address after the original one is freed is unlikely to match it
+type requestKey struct {
+	addr        uintptr
+	method, uri string
+}
+
+func newRequestKey(r *http.Request) requestKey {
+	return requestKey{addr: reflect.ValueOf(r).Pointer(), method: r.Method, uri: r.RequestURI}
+}
+
+// defaultRequestIDTags maps tag names to names of request headers used by
+// AttachRequestInfo unless WithRequestIDTags is used
+var defaultRequestIDTags = map[string]string{
+	"request_id":     "X-Request-Id",
+	"correlation_id": "X-Correlation-Id",
+}
+
+// HasRequestInfo reports whether logger is a *Client with request
+// information attached by AttachRequestInfo. Layered HTTP handlers can use it
+// to avoid attaching request information more than once.
+func HasRequestInfo(l Logger) bool {
+	c, ok := l.(*Client)
+	return ok && c != nil && c.httpReq != nil
+}
+
+// AttachResponseInfo returns sublogger that sends given HTTP response status
+// code as "http.status_code" tag and response context with every message it
+// logs. If size is not negative, it is reported as response body size. This
+// is meant to be used after handler has written response, together with
+// AttachRequestInfo. If logger is not *Client, original logger is returned.
+func AttachResponseInfo(l Logger, status int, size int64) Logger {
+	c, ok := l.(*Client)
+	if !ok || c == nil {
+		return l
+	}
+	resp := struct {
+		Type   string `json:"type"`
+		Status int    `json:"status_code"`
+		Size   *int64 `json:"body_size,omitempty"`
+	}{Type: "response", Status: status}
+	if size >= 0 {
+		resp.Size = &size
+	}
+	l = AttachTags(c, map[string]string{"http.status_code": strconv.Itoa(status)})
+	return AttachContext(l, "response", resp)
+}
+
+// AttachTransaction returns sublogger that reports given transaction name,
+// i.e. HTTP route or background task name, for every message it logs. Source
+// tells Sentry how the name was derived, so that it can group high-cardinality
+// names, such as URLs with path parameters, correctly. Source should be one of
+// "custom", "url", "route", "view", "component", or "task", or empty if it is
+// not known. If logger is not *Client, original logger is returned.
+func AttachTransaction(l Logger, name, source string) Logger {
+	c, ok := l.(*Client)
+	if !ok || c == nil {
+		return l
+	}
+	c2 := c.clone()
+	c2.transaction, c2.txSource = name, source
 	return c2
 }
 
@@ -40,34 +152,423 @@ func AttachRequestInfo(l Logger, r *http.Request) Logger {
 // logs. If logger is not *Client, original logger is returned.
 func AttachTags(l Logger, tags map[string]string) Logger {
 	c, ok := l.(*Client)
-	if !ok || len(tags) == 0 {
+	if !ok || c == nil || len(tags) == 0 {
 		return l
 	}
 	c2 := c.clone()
-	c2.tags = make(map[string]string, len(c.tags)+len(tags))
-	for k, v := range c.tags {
-		c2.tags[k] = v
+	c2.tags = mergeTags(c.tags, tags)
+	return c2
+}
+
+// AttachTagf returns sublogger that sends additional tag with given key and
+// value formatted in the manner of fmt.Sprintf for every message it logs. If
+// logger is not *Client, original logger is returned.
+func AttachTagf(l Logger, key, format string, args ...interface{}) Logger {
+	if _, ok := l.(*Client); !ok {
+		return l
+	}
+	return AttachTags(l, map[string]string{key: fmt.Sprintf(format, args...)})
+}
+
+// mergeTags returns new map holding tags from both maps, tags from over take
+// precedence over tags from base.
+func mergeTags(base, over map[string]string) map[string]string {
+	out := make(map[string]string, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		out[k] = v
 	}
-	for k, v := range tags {
-		c2.tags[k] = v
+	return out
+}
+
+// mergeExtra replaces evt extra data with JSON object holding its fields
+// overridden with values of extra encoded by evt.marshal (see encodeExtra).
+// Fields of evt extra data are only decoded if they are not known already, so
+// extra data attached to Client is not decoded for every event. On error evt
+// is not modified.
+func (evt *event) mergeExtra(extra map[string]interface{}) error {
+	base := evt.extraFields
+	if base == nil && len(evt.Extra) > 0 {
+		var err error
+		if base, err = decodeExtra(evt.Extra); err != nil {
+			return err
+		}
+	}
+	fields := make(map[string]json.RawMessage, len(base)+len(extra))
+	for k, v := range base {
+		fields[k] = v
+	}
+	for k, v := range extra {
+		data, err := encodeExtra(evt.marshal, v)
+		if err != nil {
+			return err
+		}
+		fields[k] = data
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+	buf := []byte{'{'}
+	for i, k := range keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		name, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		buf = append(append(append(buf, name...), ':'), fields[k]...)
+	}
+	evt.Extra, evt.extraFields = append(buf, '}'), fields
+	return nil
+}
+
+// decodeExtra returns fields of JSON object data
+func decodeExtra(data json.RawMessage) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return nil, errors.New("extra data is not a JSON object")
+	}
+	return fields, nil
+}
+
+// AttachTagsFromContext returns sublogger that sends tags extracted from ctx
+// with every message it logs. Each key is looked up in ctx with ctx.Value; tag
+// name is the key itself if it is a string or implements fmt.Stringer, tag
+// value must be either a string, fmt.Stringer, or one of the integer types.
+// Keys which have no value in ctx or whose key or value are of other types or
+// are nil pointers are skipped. If logger is not *Client, original logger is
+// returned.
+func AttachTagsFromContext(l Logger, ctx context.Context, keys ...interface{}) Logger {
+	if _, ok := l.(*Client); !ok || ctx == nil {
+		return l
+	}
+	tags := make(map[string]string, len(keys))
+	for _, k := range keys {
+		name, ok := tagString(k)
+		if !ok || name == "" {
+			continue
+		}
+		if val, ok := tagString(ctx.Value(k)); ok {
+			tags[name] = val
+		}
+	}
+	return AttachTags(l, tags)
+}
+
+// tagString returns string representation of v suitable to be used as a tag
+// name or value. It returns false if v is not of supported type or is a nil
+// pointer, whose String method may panic.
+func tagString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case fmt.Stringer:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return "", false
+		}
+		return v.String(), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// encodeExtra encodes v with marshal function configured by WithExtraMarshaler,
+// or with json.Marshal if marshal is nil. Output of marshal is checked to be
+// valid JSON.
+func encodeExtra(marshal func(interface{}) (json.RawMessage, error), v interface{}) (json.RawMessage, error) {
+	if marshal == nil {
+		return json.Marshal(v)
+	}
+	data, err := marshal(v)
+	if err == nil && !json.Valid(data) {
+		err = errors.New("extra marshaler returned invalid JSON")
+	}
+	return data, err
+}
+
+// isJSONObject reports whether valid JSON data holds an object
+func isJSONObject(data json.RawMessage) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{'
+}
+
+// AttachServerName returns sublogger that reports given name as the server
+// name of every message it logs instead of the local hostname. This can be
+// used by services relaying errors on behalf of other hosts. If logger is not
+// *Client, original logger is returned.
+func AttachServerName(l Logger, name string) Logger {
+	c, ok := l.(*Client)
+	if !ok || c == nil {
+		return l
+	}
+	c2 := c.clone()
+	c2.hostname = name
+	return c2
+}
+
+// AttachMinLevel returns sublogger that only sends messages of given level or
+// more severe, overriding threshold configured with WithMinLevel. This can be
+// used to enable debug messages for a single component while the rest of the
+// program only reports errors. If logger is not *Client or level is not
+// valid, original logger is returned.
+func AttachMinLevel(l Logger, level Severity) Logger {
+	c, ok := l.(*Client)
+	if !ok || c == nil || !level.valid() {
+		return l
+	}
+	c2 := c.clone()
+	c2.minLevel = level
 	return c2
 }
 
 // AttachExtra returns sublogger that sends an arbitrary mapping of additional
-// metadata for every message it logs. This function calls json.Marshal on
-// provided interface{} and does not retain pointers to it. If logger is not
-// a *Client or data cannot be marshalled, original logger is returned.
+// metadata for every message it logs. This function calls json.Marshal (or
+// function configured with WithExtraMarshaler) on provided interface{} and
+// does not retain pointers to it. If logger is not a *Client or data cannot be
+// marshalled into JSON object, original logger is returned; marshalling error
+// is logged to Logger configured with WithLogger.
 func AttachExtra(l Logger, extra interface{}) Logger {
 	c, ok := l.(*Client)
+	if !ok || c == nil {
+		return l
+	}
+	data, err := encodeExtra(c.marshalExtra, extra)
+	var fields map[string]json.RawMessage
+	if err == nil {
+		fields, err = decodeExtra(data)
+	}
+	if err != nil {
+		if c.log != nil {
+			c.log.Printf("raven failed to marshal extra data: %v", err)
+		}
+		return l
+	}
+	c2 := c.clone()
+	c2.extra, c2.extraFields = data, fields
+	return c2
+}
+
+// AttachFrameVars returns sublogger that reports given local variables on the
+// top stack frame of the main exception of every message it logs, where
+// Sentry shows them next to the frame source. This is mostly useful for panic
+// capture, where the caller knows the state that led to a panic:
+//
+//	defer func() {
+//		if v := recover(); v != nil {
+//			l := raven.AttachFrameVars(logger, map[string]interface{}{"id": id})
+//			l.(*raven.Client).CapturePanic(v, debug.Stack())
+//		}
+//	}()
+//
+// Values are formatted in the manner of fmt.Print at the time of the call and
+// truncated to 200 characters. Variables attached earlier with the same names
+// are replaced. Up to 10 variables are kept: vars take precedence over
+// variables attached earlier, within each group names are taken in sorted
+// order; names of dropped variables are reported to Logger configured with
+// WithLogger.
+// Messages without errors, or with errors without stack traces, do not
+// report variables. If logger is not *Client, original logger is returned.
+func AttachFrameVars(l Logger, vars map[string]interface{}) Logger {
+	c, ok := l.(*Client)
+	if !ok || c == nil || len(vars) == 0 {
+		return l
+	}
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var older []string
+	for k := range c.frameVars {
+		if _, ok := vars[k]; !ok {
+			older = append(older, k)
+		}
+	}
+	sort.Strings(older)
+	names = append(names, older...)
+	var dropped []string
+	if len(names) > maxFrameVars {
+		names, dropped = names[:maxFrameVars], names[maxFrameVars:]
+	}
+	merged := make(map[string]string, len(names))
+	for _, k := range names {
+		if v, ok := vars[k]; ok {
+			merged[k] = truncateText(fmt.Sprint(v), maxFrameVarLen)
+		} else {
+			merged[k] = c.frameVars[k]
+		}
+	}
+	if len(dropped) > 0 && c.log != nil {
+		c.log.Printf("raven dropped frame variables above limit of %d: %s",
+			maxFrameVars, strings.Join(dropped, ", "))
+	}
+	c2 := c.clone()
+	c2.frameVars = merged
+	return c2
+}
+
+const (
+	maxFrameVars   = 10  // max. number of variables attached to a frame
+	maxFrameVarLen = 200 // max. length of variable value in characters
+)
+
+// AttachMeasurement returns sublogger that reports named numeric value, like
+// request latency or payload size, as a measurement of every message it logs.
+// unit is optional; it can be one of units known to Sentry, like
+// "millisecond", "byte" or "percent", or a custom unit of up to 15 letters,
+// digits and underscores. Measurement with the same name attached earlier is
+// replaced. If logger is not *Client, name is empty, value is not finite or
+// unit is not valid, original logger is returned.
+func AttachMeasurement(l Logger, name string, value float64, unit string) Logger {
+	c, ok := l.(*Client)
+	if !ok || c == nil || name == "" || math.IsNaN(value) || math.IsInf(value, 0) {
+		return l
+	}
+	unit, ok = measurementUnit(unit)
 	if !ok {
 		return l
 	}
-	data, err := json.Marshal(extra)
+	c2 := c.clone()
+	c2.measures = make(map[string]measurement, len(c.measures)+1)
+	for k, v := range c.measures {
+		c2.measures[k] = v
+	}
+	c2.measures[name] = measurement{Value: value, Unit: unit}
+	return c2
+}
+
+// measurementUnit returns normalized measurement unit and reports whether it
+// is valid
+func measurementUnit(unit string) (string, bool) {
+	if unit == "" {
+		return "", true
+	}
+	if u := strings.ToLower(unit); knownUnits[u] {
+		return u, true
+	}
+	if len(unit) > 15 {
+		return "", false
+	}
+	for _, r := range unit {
+		if r != '_' && !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return "", false
+		}
+	}
+	return unit, true
+}
+
+// https://develop.sentry.dev/sdk/event-payloads/measurements/#units
+var knownUnits = map[string]bool{
+	"nanosecond": true, "microsecond": true, "millisecond": true,
+	"second": true, "minute": true, "hour": true, "day": true, "week": true,
+
+	"bit": true, "byte": true,
+	"kilobyte": true, "kibibyte": true, "megabyte": true, "mebibyte": true,
+	"gigabyte": true, "gibibyte": true, "terabyte": true, "tebibyte": true,
+	"petabyte": true, "pebibyte": true, "exabyte": true, "exbibyte": true,
+
+	"ratio": true, "percent": true, "none": true,
+}
+
+// AttachExtraRaw is like AttachExtra, but takes already encoded JSON object
+// which is used as is, without re-encoding. raw is copied, so it's safe to
+// modify it after this call. If logger is not a *Client or raw is not a valid
+// JSON object, original logger is returned; validation error is logged to
+// Logger configured with WithLogger.
+func AttachExtraRaw(l Logger, raw json.RawMessage) Logger {
+	c, ok := l.(*Client)
+	if !ok || c == nil {
+		return l
+	}
+	fields, err := decodeExtra(raw)
+	if err != nil {
+		if c.log != nil {
+			c.log.Printf("raven failed to attach extra data: %v", err)
+		}
+		return l
+	}
+	c2 := c.clone()
+	c2.extra, c2.extraFields = append(json.RawMessage(nil), raw...), fields
+	return c2
+}
+
+// AttachFile returns sublogger that sends file with given name and content as
+// an attachment with every message it logs. This can be used to attach the
+// last lines of a log file or an in-memory log buffer to error reports.
+//
+// Data larger than 256KiB is truncated to its last 256KiB. Total size of all
+// files attached to a sublogger is limited to 1MiB, if adding this file
+// exceeds this limit, it is not attached and this is reported to Logger
+// configured with WithLogger. Data is copied, so it's safe to modify it after
+// this call. If logger is not *Client, original logger is returned.
+func AttachFile(l Logger, filename string, data []byte) Logger {
+	c, ok := l.(*Client)
+	if !ok || c == nil || len(data) == 0 {
+		return l
+	}
+	if len(data) > maxAttachmentSize {
+		data = data[len(data)-maxAttachmentSize:]
+	}
+	total := len(data)
+	for _, a := range c.attachments {
+		total += len(a.data)
+	}
+	if total > maxAttachmentsSize {
+		if c.log != nil {
+			c.log.Printf("raven dropped attachment %q: total size of attachments exceeds %d bytes",
+				filename, maxAttachmentsSize)
+		}
+		return l
+	}
+	c2 := c.clone()
+	c2.attachments = make([]attachment, len(c.attachments), len(c.attachments)+1)
+	copy(c2.attachments, c.attachments)
+	c2.attachments = append(c2.attachments, attachment{
+		name: filename,
+		data: append([]byte(nil), data...),
+	})
+	return c2
+}
+
+// AttachStartTime returns sublogger that sends time elapsed since t, in
+// milliseconds, as "duration_ms" extra field of every message it logs. This
+// can be used to report how long an operation ran before it failed. If
+// logger is not *Client, original logger is returned.
+func AttachStartTime(l Logger, t time.Time) Logger {
+	c, ok := l.(*Client)
+	if !ok || c == nil {
+		return l
+	}
+	c2 := c.clone()
+	c2.startTime = t
+	return c2
+}
+
+// AttachContext returns sublogger that sends data as a named context with
+// every message it logs, Sentry shows each context as a separate card on event
+// page. This function calls json.Marshal on data and does not retain pointers
+// to it, data should be marshalled into JSON object. If logger is not a
+// *Client or data cannot be marshalled, original logger is returned.
+func AttachContext(l Logger, key string, data interface{}) Logger {
+	c, ok := l.(*Client)
+	if !ok || c == nil || key == "" {
+		return l
+	}
+	raw, err := json.Marshal(data)
 	if err != nil {
 		return l
 	}
 	c2 := c.clone()
-	c2.extra = data
+	c2.contexts = make(map[string]json.RawMessage, len(c.contexts)+1)
+	for k, v := range c.contexts {
+		c2.contexts[k] = v
+	}
+	c2.contexts[key] = raw
 	return c2
 }
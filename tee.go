@@ -0,0 +1,49 @@
+package raven
+
+import (
+	"fmt"
+	"log"
+)
+
+// Tee returns Logger which logs every message both to local logger and to c.
+// Local logger keeps its own prefix, flags and output; file and line it
+// reports with log.Lshortfile or log.Llongfile flags point to the Tee caller.
+// Messages are sent to Sentry the same way as if logged with c directly, so
+// their level still depends on whether arguments contain errors. Note that c
+// also forwards messages to Logger configured with WithLogger, if any, so it
+// should not be the same as local.
+//
+// This is useful when migrating existing code from *log.Logger
+// incrementally. Returned Logger is not *Client, so functions creating
+// subloggers, like AttachTags, return it as is; create subloggers from c
+// before passing it to Tee. If either local or c is nil, Tee logs only to the
+// other one.
+func Tee(local *log.Logger, c *Client) Logger {
+	return &tee{local: local, c: c}
+}
+
+type tee struct {
+	local *log.Logger
+	c     *Client
+}
+
+func (t *tee) Print(v ...interface{}) {
+	if t.local != nil {
+		t.local.Output(2, fmt.Sprint(v...))
+	}
+	t.c.Print(v...)
+}
+
+func (t *tee) Printf(format string, v ...interface{}) {
+	if t.local != nil {
+		t.local.Output(2, fmt.Sprintf(format, v...))
+	}
+	t.c.Printf(format, v...)
+}
+
+func (t *tee) Println(v ...interface{}) {
+	if t.local != nil {
+		t.local.Output(2, fmt.Sprintln(v...))
+	}
+	t.c.Println(v...)
+}
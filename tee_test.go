@@ -0,0 +1,38 @@
+package raven
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestTee(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := &Client{
+		shared:   new(shared),
+		messages: make(chan *message, 2),
+	}
+	l := Tee(log.New(buf, "local: ", log.Lshortfile), c)
+	l.Print("informational message")
+	l.Printf("failure: %v", errors.New("boom"))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "local: tee_test.go:") ||
+		!strings.HasSuffix(lines[1], ": failure: boom") {
+		t.Fatalf("wrong local output: %q", buf.String())
+	}
+	for _, want := range []string{"info", "error"} {
+		var evt struct {
+			Level string `json:"level"`
+		}
+		if err := json.Unmarshal((<-c.messages).payload, &evt); err != nil {
+			t.Fatal(err)
+		}
+		if evt.Level != want {
+			t.Errorf("wrong event level: got %q, want %q", evt.Level, want)
+		}
+	}
+	Tee(nil, nil).Println("no-op")
+}
@@ -0,0 +1,146 @@
+package raven
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxThreads      = 50 // max. number of goroutines reported in threads interface
+	maxThreadFrames = 20 // max. number of frames reported per goroutine
+)
+
+// WithThreadDump configures Client to report stack traces of all goroutines
+// as Sentry threads interface with fatal events, i.e. recovered panics.
+// Goroutine which creates event is marked as crashed one. At most 50
+// goroutines are reported, with at most 20 frames each. Collecting stack
+// traces of all goroutines stops the world, so this option is off by
+// default. See also WithGoroutineDumpOnFatal.
+func WithThreadDump(enable bool) ConfFunc {
+	return func(c *Client) (*Client, error) {
+		if c == nil {
+			c = new(Client)
+		}
+		c.init()
+		c.threadDump = enable
+		return c, nil
+	}
+}
+
+// https://develop.sentry.dev/sdk/event-payloads/threads/
+type threads struct {
+	Values []thread `json:"values"`
+}
+
+type thread struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Crashed bool   `json:"crashed,omitempty"`
+	Current bool   `json:"current,omitempty"`
+	Trace   struct {
+		Frames []frame `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+// addThreads fills threads interface of event from stack traces of all
+// goroutines
+func (evt *event) addThreads() {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	gs := parseGoroutines(buf)
+	if len(gs) > maxThreads {
+		gs = gs[:maxThreads]
+	}
+	evt.Threads = &threads{Values: make([]thread, 0, len(gs))}
+	for i, g := range gs {
+		panicking := hasPanicFrame(g.frames)
+		frames := trimPanicFrames(g.frames)
+		if i == 0 && !panicking { // goroutine creating event, skip raven frames
+			for len(frames) > 1 && (frames[0].Module == "runtime" ||
+				frames[0].Module == packagePath) {
+				frames = frames[1:]
+			}
+		}
+		if len(frames) > maxThreadFrames {
+			frames = frames[:maxThreadFrames]
+		}
+		t := thread{ID: g.id, Name: g.state, Crashed: i == 0, Current: i == 0}
+		t.Trace.Frames = frames
+		evt.Threads.Values = append(evt.Threads.Values, t)
+	}
+}
+
+// hasPanicFrame reports whether frames include panic call
+func hasPanicFrame(frames []frame) bool {
+	for _, fr := range frames {
+		if fr.Func == "panic" {
+			return true
+		}
+	}
+	return false
+}
+
+// goroutineStack is a parsed stack trace of a single goroutine
+type goroutineStack struct {
+	id     int
+	state  string  // i.e. "running" or "chan receive"
+	frames []frame // frames with fully qualified function names
+}
+
+// parseGoroutines parses stack traces of goroutines from stack in the format
+// of runtime.Stack or runtime/debug.Stack
+func parseGoroutines(stack []byte) []goroutineStack {
+	var out []goroutineStack
+	var cur *goroutineStack
+	var fn string
+	sc := bufio.NewScanner(bytes.NewReader(stack))
+	sc.Buffer(nil, len(stack)+1)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			cur, fn = nil, ""
+		case strings.HasPrefix(line, "goroutine "):
+			out = append(out, goroutineStack{})
+			cur, fn = &out[len(out)-1], ""
+			// goroutine 1 [running]:
+			fields := strings.SplitN(strings.TrimSuffix(line, ":"), " ", 3)
+			if len(fields) > 1 {
+				cur.id, _ = strconv.Atoi(fields[1])
+			}
+			if len(fields) > 2 {
+				cur.state = strings.Trim(fields[2], "[]")
+			}
+		case cur == nil:
+		case strings.HasPrefix(line, "created by "):
+			fn = ""
+		case strings.HasPrefix(line, "\t"):
+			if fn == "" {
+				continue
+			}
+			fr := frame{Func: fn, Module: funcModule(fn)}
+			fn = ""
+			loc := strings.TrimSpace(line)
+			if i := strings.LastIndex(loc, " +0x"); i > 0 {
+				loc = loc[:i]
+			}
+			if i := strings.LastIndex(loc, ":"); i > 0 {
+				fr.Line, _ = strconv.Atoi(loc[i+1:])
+				loc = loc[:i]
+			}
+			fr.File = path.Base(loc)
+			fr.AbsPath = loc
+			cur.frames = append(cur.frames, fr)
+		default:
+			if i := strings.LastIndex(line, "("); i > 0 {
+				line = line[:i]
+			}
+			fn = line
+		}
+	}
+	return out
+}
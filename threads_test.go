@@ -0,0 +1,83 @@
+package raven
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseGoroutines(t *testing.T) {
+	const dump = `goroutine 7 [running]:
+main.work(0x1)
+	/src/main.go:12 +0x25
+main.main()
+	/src/main.go:5 +0x1d
+
+goroutine 9 [chan receive, 2 minutes]:
+github.com/foo/bar.(*Pool).wait(...)
+	/src/bar/pool.go:40
+created by github.com/foo/bar.New in goroutine 1
+	/src/bar/pool.go:20 +0x4a
+`
+	gs := parseGoroutines([]byte(dump))
+	if len(gs) != 2 {
+		t.Fatalf("wrong number of goroutines: got %d, want 2", len(gs))
+	}
+	if g := gs[0]; g.id != 7 || g.state != "running" || len(g.frames) != 2 ||
+		!reflect.DeepEqual(g.frames[0], frame{File: "main.go", AbsPath: "/src/main.go", Func: "main.work", Module: "main", Line: 12}) {
+		t.Fatalf("wrong first goroutine: %+v", g)
+	}
+	if g := gs[1]; g.id != 9 || g.state != "chan receive, 2 minutes" || len(g.frames) != 1 ||
+		g.frames[0].Module != "github.com/foo/bar" || g.frames[0].Line != 40 {
+		t.Fatalf("wrong second goroutine: %+v", g)
+	}
+}
+
+func TestWithThreadDump(t *testing.T) {
+	c, err := WithThreadDump(true)(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() { c.CapturePanic(recover(), nil) }()
+		panicFoo()
+	}()
+	var evt struct {
+		Threads struct {
+			Values []struct {
+				Crashed bool `json:"crashed"`
+				Trace   struct {
+					Frames []struct {
+						Function string `json:"function"`
+					} `json:"frames"`
+				} `json:"stacktrace"`
+			} `json:"values"`
+		} `json:"threads"`
+	}
+	if err := json.Unmarshal((<-c.messages).payload, &evt); err != nil {
+		t.Fatal(err)
+	}
+	if len(evt.Threads.Values) == 0 {
+		t.Fatal("no threads in event")
+	}
+	th := evt.Threads.Values[0]
+	if !th.Crashed {
+		t.Fatal("first thread is not marked as crashed")
+	}
+	if len(th.Trace.Frames) == 0 || th.Trace.Frames[0].Function != "panicFoo" {
+		t.Fatalf("wrong frames of crashed thread: %+v", th.Trace.Frames)
+	}
+}
+
+func TestWithThreadDump_ignored(t *testing.T) {
+	c := newTestClient(t, WithThreadDump(true), WithGoroutineDumpOnFatal(true), WithIgnoreErrors(io.EOF))
+	evt := newEvent("ignored", "", []interface{}{io.EOF}, c)
+	evt.Level = LevelFatal
+	if msg := evt.message(c); !msg.ignored {
+		t.Fatal("event with ignored error is not ignored")
+	}
+	if evt.Threads != nil || len(evt.attachments) != 0 {
+		t.Fatal("goroutines collected for ignored event")
+	}
+}